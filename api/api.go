@@ -0,0 +1,33 @@
+// Package api holds the types the inventory api reads and writes, shared by
+// the server and its client. It depends on nothing but the standard library
+// so the client can be imported without the server
+package api
+
+// IdempotencyKeyHeader carries the client chosen key of a retryable request
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// NextCursorHeader carries the cursor of the next page of a list, it is
+// absent on the last page
+const NextCursorHeader = "X-Next-Cursor"
+
+// APIError struct represents a json return erorr type
+type APIError struct {
+	Code    int          `json:"code"`
+	Message string       `json:"message"`
+	Detail  string       `json:"detail"`
+	Details []FieldError `json:"details,omitempty"`
+}
+
+// FieldError describes why one field of a request was rejected
+type FieldError struct {
+	Field   string   `json:"field"`
+	Message string   `json:"message"`
+	Allowed []string `json:"allowed,omitempty"`
+}
+
+// Violation is one aws or dns limit a generated name or tag broke
+type Violation struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
@@ -0,0 +1,60 @@
+package api
+
+import "time"
+
+// Color is a color of the palette and the state it is listed in
+type Color struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	InUse     bool      `json:"in_use"`
+	LastInUse time.Time `json:"last_in_use"`
+	Blocked   bool      `json:"blocked"`
+	State     string    `json:"state,omitempty"`
+	Holder    string    `json:"holder,omitempty"`
+}
+
+// ColorAssignment is one period during which a color was held, by an
+// instance or by an allocation waiting for its instance to launch
+type ColorAssignment struct {
+	ID         int        `json:"id"`
+	Color      string     `json:"color"`
+	InstanceID string     `json:"instance_id"`
+	AccountID  string     `json:"account_id"`
+	Owner      string     `json:"owner"`
+	StartedAt  time.Time  `json:"started_at"`
+	EndedAt    *time.Time `json:"ended_at"`
+}
+
+// ColorCounts holds the number of colors in each lifecycle state
+type ColorCounts struct {
+	Free        int `json:"free"`
+	InUse       int `json:"in_use"`
+	CoolingDown int `json:"cooling_down"`
+	Blocked     int `json:"blocked"`
+}
+
+// ColorSummary counts the colors in each state under the cooldown of
+// ?environment=
+type ColorSummary struct {
+	Scope    string      `json:"scope"`
+	Cooldown string      `json:"cooldown"`
+	Total    int         `json:"total"`
+	Counts   ColorCounts `json:"counts"`
+}
+
+// ColorsRequest is the body of a bulk color add
+type ColorsRequest struct {
+	Names []string `json:"names"`
+}
+
+// ColorsResponse reports which of the requested colors were added
+type ColorsResponse struct {
+	Added   []string `json:"added"`
+	Skipped []string `json:"skipped"`
+}
+
+// ColorPatch is the body of a color update
+type ColorPatch struct {
+	Blocked *bool  `json:"blocked"`
+	Reason  string `json:"reason,omitempty"`
+}
@@ -0,0 +1,69 @@
+package api
+
+// TagsRequest ...
+type TagsRequest struct {
+	Role        string `json:"primary_role"`
+	Environment string `json:"environment"`
+	SubnetID    string `json:"subnet_id"`
+	Pool        string `json:"pool,omitempty"`
+	Color       string `json:"color,omitempty"`
+	Name        string `json:"name"`
+	Owner       string `json:"owner,omitempty"`
+	// Replaces is the instance being rebuilt, whose color may be requested
+	// back while it is still in use or cooling down
+	Replaces string `json:"replaces_instance_id,omitempty"`
+}
+
+// TagsResponse is an allocated host, the request's fields as they were
+// allocated along with the host's tags
+type TagsResponse struct {
+	TagsRequest
+	// Tags is the full tag set of the host as a map for terraform, EC2Tags
+	// the same set as a list for EC2 CreateTags
+	Tags    map[string]string `json:"tags,omitempty"`
+	EC2Tags []EC2Tag          `json:"ec2_tags,omitempty"`
+	// Violations reports the aws limits the name and tags were truncated to
+	Violations []Violation `json:"violations,omitempty"`
+}
+
+// EC2Tag is a tag in the form EC2 CreateTags accepts
+type EC2Tag struct {
+	Key   string `json:"Key"`
+	Value string `json:"Value"`
+}
+
+// BulkTagsRequest asks for several hosts at once, either count hosts of one
+// role, environment and pool spread over the AZs of subnet_ids, or a list of
+// individual requests
+type BulkTagsRequest struct {
+	Count       int            `json:"count,omitempty"`
+	Role        string         `json:"primary_role,omitempty"`
+	Environment string         `json:"environment,omitempty"`
+	Pool        string         `json:"pool,omitempty"`
+	SubnetIDs   []string       `json:"subnet_ids,omitempty"`
+	Hosts       []*TagsRequest `json:"hosts,omitempty"`
+}
+
+// BulkTagsResponse lists the allocated hosts in request order
+type BulkTagsResponse struct {
+	Hosts []*TagsResponse `json:"hosts"`
+}
+
+// Host is a synced ec2 instance
+type Host struct {
+	ID         int               `json:"id"`
+	InstanceID string            `json:"instance_id"`
+	AccountID  string            `json:"account_id"`
+	SubnetID   string            `json:"subnet_id"`
+	Tags       map[string]string `json:"tags"`
+}
+
+// Subnet is a synced subnet
+type Subnet struct {
+	ID        int               `json:"id"`
+	SubnetID  string            `json:"subnet_id"`
+	VpcID     string            `json:"vpc_id"`
+	AccountID string            `json:"account_id"`
+	AZ        string            `json:"availability_zone"`
+	Tags      map[string]string `json:"tags"`
+}
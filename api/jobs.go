@@ -0,0 +1,23 @@
+package api
+
+import "time"
+
+// JobStatus describes a registered runner and its most recent run
+type JobStatus struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Interval    int     `json:"interval_seconds"`
+	Running     bool    `json:"running"`
+	LastRun     *JobRun `json:"last_run,omitempty"`
+}
+
+// JobRun records a single execution of a runner
+type JobRun struct {
+	ID          int       `json:"id"`
+	JobName     string    `json:"job_name"`
+	StartedAt   time.Time `json:"started_at"`
+	FinishedAt  time.Time `json:"finished_at"`
+	DurationMS  int64     `json:"duration_ms"`
+	ItemsSynced int       `json:"items_synced"`
+	Error       string    `json:"error,omitempty"`
+}
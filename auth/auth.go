@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Role is a permission level, each role includes the ones below it
+type Role int
+
+// the roles a caller can hold in increasing order of privilege
+const (
+	RoleNone Role = iota
+	RoleRead
+	RoleAllocate
+	RoleAdmin
+)
+
+var roleNames = map[Role]string{
+	RoleNone:     "none",
+	RoleRead:     "read",
+	RoleAllocate: "allocate",
+	RoleAdmin:    "admin",
+}
+
+// String ...
+func (r Role) String() string {
+	if name, ok := roleNames[r]; ok {
+		return name
+	}
+	return fmt.Sprintf("role(%d)", int(r))
+}
+
+// Allows reports whether the role grants at least the required role
+func (r Role) Allows(required Role) bool {
+	return r >= required
+}
+
+// ParseRole turns read, allocate or admin into a Role
+func ParseRole(s string) (Role, error) {
+	for role, name := range roleNames {
+		if role != RoleNone && strings.EqualFold(strings.TrimSpace(s), name) {
+			return role, nil
+		}
+	}
+	return RoleNone, fmt.Errorf("unknown role %q", s)
+}
+
+// Identity is an authenticated caller
+type Identity struct {
+	Subject string `json:"subject"`
+	Method  string `json:"method"`
+	Role    Role   `json:"-"`
+}
+
+// String returns method:subject, used as the caller in logs
+func (i *Identity) String() string {
+	return i.Method + ":" + i.Subject
+}
+
+// ErrNoCredentials is returned by an Authenticator when the request carries
+// nothing it understands so the next one can be tried
+var ErrNoCredentials = errors.New("no credentials presented")
+
+// ErrInvalidCredentials is returned when credentials were presented but are
+// not valid
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// ErrUnavailable is returned when credentials could not be checked, e.g. the
+// tokens could not be read, the caller should retry rather than drop them
+var ErrUnavailable = errors.New("authentication unavailable")
+
+// Authenticator resolves the identity of the caller of a request
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Identity, error)
+}
+
+// Chain tries each authenticator in order until one recognises the request
+type Chain []Authenticator
+
+// Authenticate satisfies Authenticator, a request rejected by one member of
+// the chain is not retried against the rest
+func (c Chain) Authenticate(r *http.Request) (*Identity, error) {
+	for _, a := range c {
+		id, err := a.Authenticate(r)
+		if err == ErrNoCredentials {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return id, nil
+	}
+
+	return nil, ErrNoCredentials
+}
+
+// bearerToken returns the token of an Authorization: Bearer header
+func bearerToken(r *http.Request) (string, bool) {
+	h := r.Header.Get("Authorization")
+	const prefix = "bearer "
+	if len(h) <= len(prefix) || !strings.EqualFold(h[:len(prefix)], prefix) {
+		return "", false
+	}
+	return strings.TrimSpace(h[len(prefix):]), true
+}
+
+// isJWT reports whether a bearer token looks like a compact jws
+func isJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+type contextKey int
+
+const identityKey contextKey = iota
+
+// NewContext returns a copy of ctx carrying the identity
+func NewContext(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityKey, id)
+}
+
+// FromContext returns the identity stored in ctx, if any
+func FromContext(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(identityKey).(*Identity)
+	return id, ok
+}
@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// CertAuthenticator identifies callers by the common name of a verified
+// client certificate
+type CertAuthenticator struct {
+	roles       map[string]Role
+	defaultRole Role
+}
+
+// NewCertAuthenticator returns an authenticator granting roles by common
+// name, verified certificates not in roles get defaultRole
+func NewCertAuthenticator(roles map[string]Role, defaultRole Role) *CertAuthenticator {
+	return &CertAuthenticator{roles: roles, defaultRole: defaultRole}
+}
+
+// Authenticate satisfies Authenticator, only chains verified by the tls
+// listener against the client ca are trusted
+func (c *CertAuthenticator) Authenticate(r *http.Request) (*Identity, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, ErrNoCredentials
+	}
+
+	cn := r.TLS.VerifiedChains[0][0].Subject.CommonName
+	if cn == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	role, ok := c.roles[cn]
+	if !ok {
+		role = c.defaultRole
+	}
+
+	if role == RoleNone {
+		return nil, ErrInvalidCredentials
+	}
+
+	return &Identity{Subject: cn, Method: "mtls", Role: role}, nil
+}
+
+// ParseRoleMap parses name=role pairs separated by commas
+func ParseRoleMap(s string) (map[string]Role, error) {
+	roles := make(map[string]Role)
+
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("role mapping %q must be name=role", pair)
+		}
+
+		role, err := ParseRole(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		roles[strings.TrimSpace(parts[0])] = role
+	}
+
+	return roles, nil
+}
@@ -0,0 +1,366 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultJWKSRefresh is how long fetched signing keys are trusted
+const DefaultJWKSRefresh = 10 * time.Minute
+
+// minJWKSRefetch limits refetches triggered by unknown key ids
+const minJWKSRefetch = time.Minute
+
+// DefaultRoleClaim is the claim read for roles when none is configured
+const DefaultRoleClaim = "roles"
+
+// JWKS fetches and caches the signing keys published by an oidc provider
+type JWKS struct {
+	url     string
+	client  *http.Client
+	refresh time.Duration
+
+	mu      sync.Mutex
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+}
+
+// NewJWKS returns a key set backed by the jwks document at url
+func NewJWKS(url string) *JWKS {
+	return &JWKS{
+		url:     url,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		refresh: DefaultJWKSRefresh,
+	}
+}
+
+// jsonWebKey is the subset of rfc 7517 needed for rsa and ec keys
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// Key returns the key with the given id, refetching the set when it is stale
+// or the id is unknown
+func (k *JWKS) Key(kid string) (crypto.PublicKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	stale := time.Since(k.fetched) > k.refresh
+	key, ok := k.keys[kid]
+	if ok && !stale {
+		return key, nil
+	}
+
+	if stale || time.Since(k.fetched) > minJWKSRefetch {
+		if err := k.fetch(); err != nil {
+			// keep serving cached keys if the provider is briefly unreachable
+			if ok {
+				return key, nil
+			}
+			return nil, err
+		}
+	}
+
+	key, ok = k.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+// fetch replaces the cached keys, the caller must hold mu
+func (k *JWKS) fetch() error {
+	resp, err := k.client.Get(k.url)
+	if err != nil {
+		return fmt.Errorf("could not fetch jwks: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("could not fetch jwks: status %d", resp.StatusCode)
+	}
+
+	var doc struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return fmt.Errorf("could not decode jwks: %s", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(doc.Keys))
+	for _, jwk := range doc.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+
+	k.keys = keys
+	k.fetched = time.Now()
+	return nil
+}
+
+func (j jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch j.Kty {
+	case "RSA":
+		n, err := decodeBigInt(j.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(j.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch j.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", j.Crv)
+		}
+		x, err := decodeBigInt(j.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(j.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", j.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode key parameter: %s", err)
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// KeySource resolves the public key a token was signed with
+type KeySource interface {
+	Key(kid string) (crypto.PublicKey, error)
+}
+
+// OIDCAuthenticator validates bearer jwts issued by an oidc provider
+type OIDCAuthenticator struct {
+	keys      KeySource
+	issuer    string
+	audience  string
+	roleClaim string
+	leeway    time.Duration
+	now       func() time.Time
+}
+
+// NewOIDCAuthenticator returns an authenticator accepting tokens signed by
+// keys, issued by issuer for audience, with roles read from roleClaim
+func NewOIDCAuthenticator(keys KeySource, issuer, audience, roleClaim string) *OIDCAuthenticator {
+	if roleClaim == "" {
+		roleClaim = DefaultRoleClaim
+	}
+
+	return &OIDCAuthenticator{
+		keys:      keys,
+		issuer:    issuer,
+		audience:  audience,
+		roleClaim: roleClaim,
+		leeway:    time.Minute,
+		now:       time.Now,
+	}
+}
+
+// Authenticate satisfies Authenticator
+func (o *OIDCAuthenticator) Authenticate(r *http.Request) (*Identity, error) {
+	token, ok := bearerToken(r)
+	if !ok || !isJWT(token) {
+		return nil, ErrNoCredentials
+	}
+
+	claims, err := o.verify(token)
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	role := roleFromClaim(claims[o.roleClaim])
+	if role == RoleNone {
+		return nil, ErrInvalidCredentials
+	}
+
+	return &Identity{Subject: subject, Method: "oidc", Role: role}, nil
+}
+
+// verify checks the signature and registered claims and returns all claims
+func (o *OIDCAuthenticator) verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+
+	key, err := o.keys.Key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("could not decode signature: %s", err)
+	}
+
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	claims := map[string]interface{}{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+
+	now := o.now()
+
+	exp, ok := claims["exp"].(float64)
+	if !ok || now.After(time.Unix(int64(exp), 0).Add(o.leeway)) {
+		return nil, fmt.Errorf("token is expired")
+	}
+
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(o.leeway).Before(time.Unix(int64(nbf), 0)) {
+		return nil, fmt.Errorf("token is not yet valid")
+	}
+
+	if iss, _ := claims["iss"].(string); iss != o.issuer {
+		return nil, fmt.Errorf("unexpected issuer %q", iss)
+	}
+
+	if !hasAudience(claims["aud"], o.audience) {
+		return nil, fmt.Errorf("token not issued for %q", o.audience)
+	}
+
+	return claims, nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return fmt.Errorf("could not decode token segment: %s", err)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("could not unmarshal token segment: %s", err)
+	}
+	return nil
+}
+
+// verifySignature checks sig over signed with key using the jws alg
+func verifySignature(alg string, key crypto.PublicKey, signed string, sig []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			return fmt.Errorf("algorithm %s does not match rsa key", alg)
+		}
+		return rsa.VerifyPKCS1v15(k, hash, digest, sig)
+	case *ecdsa.PublicKey:
+		if !strings.HasPrefix(alg, "ES") {
+			return fmt.Errorf("algorithm %s does not match ec key", alg)
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return fmt.Errorf("invalid ecdsa signature length")
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return fmt.Errorf("invalid ecdsa signature")
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unsupported key %T", key)
+}
+
+func hasAudience(aud interface{}, want string) bool {
+	switch a := aud.(type) {
+	case string:
+		return a == want
+	case []interface{}:
+		for _, v := range a {
+			if s, ok := v.(string); ok && s == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// roleFromClaim returns the highest role named by a string or list claim
+func roleFromClaim(claim interface{}) Role {
+	var values []string
+	switch c := claim.(type) {
+	case string:
+		values = strings.Fields(c)
+	case []interface{}:
+		for _, v := range c {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+
+	best := RoleNone
+	for _, v := range values {
+		if role, err := ParseRole(v); err == nil && role > best {
+			best = role
+		}
+	}
+	return best
+}
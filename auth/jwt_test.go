@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const (
+	testIssuer   = "https://idp.example.com"
+	testAudience = "inventory"
+)
+
+func signTestToken(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("could not sign token: %s", err)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func serveTestJWKS(key *rsa.PrivateKey, kid string) *httptest.Server {
+	doc := map[string]interface{}{
+		"keys": []map[string]string{{
+			"kid": kid,
+			"kty": "RSA",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(doc)
+	}))
+}
+
+func bearerRequest(token string) *http.Request {
+	r := httptest.NewRequest("GET", "/v1/colors", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	return r
+}
+
+func TestOIDCAuthenticate(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwks := serveTestJWKS(key, "k1")
+	defer jwks.Close()
+
+	o := NewOIDCAuthenticator(NewJWKS(jwks.URL), testIssuer, testAudience, "")
+
+	valid := map[string]interface{}{
+		"iss":   testIssuer,
+		"aud":   []string{testAudience, "other"},
+		"sub":   "alice",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"roles": []string{"read", "allocate"},
+	}
+
+	id, err := o.Authenticate(bearerRequest(signTestToken(t, key, "k1", valid)))
+	if err != nil {
+		t.Fatalf("expected valid token to authenticate got: %s", err)
+	}
+
+	if id.Subject != "alice" || id.Role != RoleAllocate {
+		t.Errorf("expected alice with allocate got: %s %s", id.Subject, id.Role)
+	}
+
+	cases := map[string]func(map[string]interface{}){
+		"expired":       func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+		"wrong issuer":  func(c map[string]interface{}) { c["iss"] = "https://evil.example.com" },
+		"wrong aud":     func(c map[string]interface{}) { c["aud"] = "something-else" },
+		"no known role": func(c map[string]interface{}) { c["roles"] = "viewer" },
+	}
+
+	for name, mutate := range cases {
+		claims := map[string]interface{}{}
+		for k, v := range valid {
+			claims[k] = v
+		}
+		mutate(claims)
+
+		if _, err := o.Authenticate(bearerRequest(signTestToken(t, key, "k1", claims))); err != ErrInvalidCredentials {
+			t.Errorf("%s: expected invalid credentials got: %v", name, err)
+		}
+	}
+
+	other, _ := rsa.GenerateKey(rand.Reader, 2048)
+	if _, err := o.Authenticate(bearerRequest(signTestToken(t, other, "k1", valid))); err != ErrInvalidCredentials {
+		t.Errorf("expected token signed by another key to be rejected got: %v", err)
+	}
+}
+
+func TestChainSkipsUnrecognisedCredentials(t *testing.T) {
+	o := NewOIDCAuthenticator(NewJWKS("http://127.0.0.1:0"), testIssuer, testAudience, "")
+
+	// an opaque api token is not a jwt so the oidc authenticator passes
+	if _, err := o.Authenticate(bearerRequest("deadbeef")); err != ErrNoCredentials {
+		t.Errorf("expected no credentials got: %v", err)
+	}
+
+	if _, err := (Chain{o}).Authenticate(httptest.NewRequest("GET", "/", nil)); err != ErrNoCredentials {
+		t.Errorf("expected empty request to have no credentials got: %v", err)
+	}
+}
+
+func TestParseRoleMap(t *testing.T) {
+	roles, err := ParseRoleMap("ci.example.com=allocate, ops.example.com=admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if roles["ci.example.com"] != RoleAllocate || roles["ops.example.com"] != RoleAdmin {
+		t.Errorf("unexpected roles: %v", roles)
+	}
+
+	if _, err := ParseRoleMap("ci.example.com=root"); err == nil {
+		t.Errorf("expected unknown role to fail")
+	}
+
+	if !RoleAdmin.Allows(RoleRead) || RoleRead.Allows(RoleAllocate) {
+		t.Errorf("unexpected role ordering")
+	}
+}
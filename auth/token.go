@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/mleone896/inventory/models"
+)
+
+// TokenAuthenticator accepts static api tokens stored hashed in api_tokens
+type TokenAuthenticator struct {
+	db *sqlx.DB
+}
+
+// NewTokenAuthenticator returns an authenticator looking tokens up in db
+func NewTokenAuthenticator(db *sqlx.DB) *TokenAuthenticator {
+	return &TokenAuthenticator{db: db}
+}
+
+// Authenticate satisfies Authenticator, jwts are left to the oidc
+// authenticator
+func (t *TokenAuthenticator) Authenticate(r *http.Request) (*Identity, error) {
+	token, ok := bearerToken(r)
+	if !ok || isJWT(token) {
+		return nil, ErrNoCredentials
+	}
+
+	tok := models.NewAPIToken(models.WithPlainToken(token))
+	err := tok.Get(t.db)
+	if errors.Is(err, models.ErrTokenNotFound) {
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnavailable, err)
+	}
+
+	role, err := ParseRole(tok.Role)
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	return &Identity{Subject: tok.Name, Method: "token", Role: role}, nil
+}
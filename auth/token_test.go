@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/reflectx"
+)
+
+func TestTokenAuthenticate(t *testing.T) {
+	dbm, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := sqlx.NewDb(dbm, "sqlmock")
+	db.Mapper = reflectx.NewMapperFunc("json", strings.ToLower)
+	defer db.Close()
+
+	cols := []string{"id", "name", "token_hash", "role", "created_at", "revoked"}
+	mock.ExpectQuery("SELECT .* from api_tokens").
+		WillReturnRows(sqlmock.NewRows(cols).AddRow(1, "ci", "hash", "allocate", time.Now(), false))
+	mock.ExpectQuery("SELECT .* from api_tokens").
+		WillReturnRows(sqlmock.NewRows(cols))
+	mock.ExpectQuery("SELECT .* from api_tokens").
+		WillReturnError(fmt.Errorf("connection refused"))
+
+	a := NewTokenAuthenticator(db)
+
+	id, err := a.Authenticate(bearerRequest("s3cret"))
+	if err != nil || id.Subject != "ci" || id.Role != RoleAllocate {
+		t.Errorf("expected the ci token to authenticate got %+v %v", id, err)
+	}
+
+	if _, err := a.Authenticate(bearerRequest("unknown")); err != ErrInvalidCredentials {
+		t.Errorf("expected an unknown token to be invalid got %v", err)
+	}
+
+	// an outage must not make clients drop valid tokens
+	if _, err := a.Authenticate(bearerRequest("s3cret")); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("expected a failed lookup to be unavailable got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
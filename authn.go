@@ -0,0 +1,123 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/mleone896/inventory/auth"
+	"github.com/mleone896/inventory/db"
+	"github.com/mleone896/inventory/models"
+)
+
+// buildAuthenticator chains the enabled auth methods in the order given
+func buildAuthenticator(d *db.DataObj) (auth.Authenticator, error) {
+	chain := auth.Chain{}
+
+	for _, method := range strings.Split(authMethods, ",") {
+		switch strings.TrimSpace(method) {
+		case "":
+		case "none":
+			log.Println("WARNING: authentication is disabled, every route is open")
+			return nil, nil
+		case "token":
+			chain = append(chain, auth.NewTokenAuthenticator(d.Conn))
+		case "mtls":
+			if clientCA == "" {
+				return nil, fmt.Errorf("mtls auth requires -clientCA")
+			}
+			roles, err := auth.ParseRoleMap(certRoles)
+			if err != nil {
+				return nil, err
+			}
+			defaultRole := auth.RoleNone
+			if certDefaultRole != "" {
+				if defaultRole, err = auth.ParseRole(certDefaultRole); err != nil {
+					return nil, err
+				}
+			}
+			chain = append(chain, auth.NewCertAuthenticator(roles, defaultRole))
+		case "oidc":
+			if oidcIssuer == "" || oidcAudience == "" || oidcJWKS == "" {
+				return nil, fmt.Errorf("oidc auth requires -oidcIssuer, -oidcAudience and -oidcJWKS")
+			}
+			chain = append(chain, auth.NewOIDCAuthenticator(
+				auth.NewJWKS(oidcJWKS), oidcIssuer, oidcAudience, oidcRoleClaim))
+		default:
+			return nil, fmt.Errorf("unknown auth method %q", method)
+		}
+	}
+
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("no auth methods configured, use -auth none to disable authentication")
+	}
+
+	return chain, nil
+}
+
+// createAPIToken stores a new token for name with role and prints it once
+func createAPIToken(d *db.DataObj, spec string) error {
+	parts := strings.SplitN(spec, ":", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return fmt.Errorf("token must be given as name:role")
+	}
+
+	role, err := auth.ParseRole(parts[1])
+	if err != nil {
+		return err
+	}
+
+	plain, err := models.GenerateToken()
+	if err != nil {
+		return err
+	}
+
+	tok := models.NewAPIToken(
+		models.WithTokenName(parts[0]),
+		models.WithTokenRole(role.String()),
+		models.WithPlainToken(plain),
+	)
+
+	if _, err := d.Create(tok); err != nil {
+		return err
+	}
+
+	ev := models.NewAuditEvent(models.AuditTokenCreate, "cli",
+		models.WithAuditDetails(map[string]string{"name": tok.Name, "role": tok.Role}))
+	if _, err := d.Create(ev); err != nil {
+		log.Printf("could not audit token creation: %s", err)
+	}
+
+	fmt.Println(plain)
+	return nil
+}
+
+// listen serves router over tls when a certificate is configured, requesting
+// client certificates when a client ca is given
+func listen(router http.Handler) error {
+	if tlsCert == "" {
+		return http.ListenAndServe(port, router)
+	}
+
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if clientCA != "" {
+		pem, err := ioutil.ReadFile(clientCA)
+		if err != nil {
+			return fmt.Errorf("could not read client ca: %s", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", clientCA)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	srv := &http.Server{Addr: port, Handler: router, TLSConfig: cfg}
+	return srv.ListenAndServeTLS(tlsCert, tlsKey)
+}
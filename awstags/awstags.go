@@ -0,0 +1,280 @@
+// Package awstags checks generated host names and tags against the limits
+// AWS and DNS put on them, either rejecting or truncating what breaks them
+package awstags
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mleone896/inventory/api"
+)
+
+// the limits AWS puts on the tags of a resource and DNS on host names
+const (
+	MaxKeyLen      = 128
+	MaxValueLen    = 256
+	MaxTags        = 50
+	ReservedPrefix = "aws:"
+	MaxLabelLen    = 63
+	MaxHostnameLen = 253
+)
+
+// hashLen is how many hex characters of a hash end a truncated label
+const hashLen = 8
+
+// Mode decides what happens to a name or tag breaking a limit
+type Mode string
+
+// the ways limits are enforced
+const (
+	// Reject fails the allocation
+	Reject Mode = "reject"
+	// Truncate shortens or drops what breaks a limit and reports it
+	Truncate Mode = "truncate"
+)
+
+// ParseMode turns reject or truncate into a Mode
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(strings.TrimSpace(s)); m {
+	case Reject, Truncate:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown tag limit mode %q", s)
+}
+
+// the rules a violation can break
+const (
+	RuleKeyLength      = "key_length"
+	RuleValueLength    = "value_length"
+	RuleReservedPrefix = "reserved_prefix"
+	RuleEmptyKey       = "empty_key"
+	RuleTagCount       = "tag_count"
+	RuleLabelLength    = "label_length"
+	RuleHostnameLength = "hostname_length"
+	RuleHostnameChars  = "hostname_chars"
+)
+
+// Violation is one limit a name or tag broke
+type Violation = api.Violation
+
+// Violations lists every limit broken
+type Violations []Violation
+
+// Error lets violations be returned as an error
+func (v Violations) Error() string {
+	msgs := make([]string, len(v))
+	for i, e := range v {
+		msgs[i] = e.Field + " " + e.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (v *Violations) add(field, rule, format string, args ...interface{}) {
+	*v = append(*v, Violation{Field: field, Rule: rule, Message: fmt.Sprintf(format, args...)})
+}
+
+// Checker enforces the limits in its mode
+type Checker struct {
+	Mode Mode
+}
+
+// NewChecker returns a checker enforcing the limits in mode
+func NewChecker(mode Mode) *Checker {
+	return &Checker{Mode: mode}
+}
+
+// Hostname checks every label of name is at most 63 characters of lower case
+// letters, digits and inner hyphens and the whole name at most 253. When
+// truncating, long labels are cut and end with a hash of the whole label so
+// names that differed stay distinct. Characters that can't be fixed are
+// always rejected. Violations are returned as the error when rejected and
+// otherwise reported alongside the fixed name
+func (c *Checker) Hostname(name string) (string, Violations, error) {
+	v := Violations{}
+	fatal := false
+
+	labels := strings.Split(name, ".")
+	for i, label := range labels {
+		if !validLabelChars(label) {
+			v.add("name", RuleHostnameChars,
+				"label %q must be lower case letters, digits and inner hyphens", label)
+			fatal = true
+			continue
+		}
+
+		if len(label) > MaxLabelLen {
+			v.add("name", RuleLabelLength, "label %q is longer than %d characters", label, MaxLabelLen)
+			if c.truncates() {
+				labels[i] = truncateLabel(label, MaxLabelLen)
+			}
+		}
+	}
+
+	out := strings.Join(labels, ".")
+	if len(out) > MaxHostnameLen {
+		v.add("name", RuleHostnameLength, "is longer than %d characters", MaxHostnameLen)
+		fatal = true
+	}
+
+	if fatal || (len(v) > 0 && !c.truncates()) {
+		return name, v, v
+	}
+	return out, v, nil
+}
+
+// Label joins parts with hyphens into a single label host name and checks it
+// as Hostname does. When truncating a label longer than 63 characters, the
+// part at flex is cut and ends with a hash of the whole label instead, so the
+// other parts, e.g. the color and AZ ending a host name, stay intact. Labels
+// the other parts alone make too long are cut as Hostname cuts them
+func (c *Checker) Label(parts []string, flex int) (string, Violations, error) {
+	label := strings.Join(parts, "-")
+	if !c.truncates() || len(label) <= MaxLabelLen || !validLabelChars(label) {
+		return c.Hostname(label)
+	}
+
+	// what is left of the flexible part once it is shortened and hashed
+	room := len(parts[flex]) - (len(label) - MaxLabelLen) - hashLen - 1
+	if room < 1 {
+		return c.Hostname(label)
+	}
+
+	v := Violations{}
+	v.add("name", RuleLabelLength, "label %q is longer than %d characters", label, MaxLabelLen)
+
+	cut := append([]string{}, parts...)
+	cut[flex] = strings.TrimRight(parts[flex][:room], "-") + "-" + labelHash(label)
+	return strings.Join(cut, "-"), v, nil
+}
+
+// Tags checks the tag set against the AWS limits. When truncating, long keys
+// and values are cut, reserved and empty keys are dropped and, past 50 tags,
+// the tags in required are kept before the others in key order. Keys cut to
+// a key already present are dropped. Violations are returned as the error
+// when rejected and otherwise reported alongside the fixed tags
+func (c *Checker) Tags(tags map[string]string, required ...string) (map[string]string, Violations, error) {
+	v := Violations{}
+	out := make(map[string]string, len(tags))
+
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := tags[key]
+		field := "tags." + key
+
+		if strings.TrimSpace(key) == "" {
+			v.add(field, RuleEmptyKey, "key must not be empty")
+			continue
+		}
+
+		if strings.HasPrefix(strings.ToLower(key), ReservedPrefix) {
+			v.add(field, RuleReservedPrefix, "keys starting with %s are reserved by AWS", ReservedPrefix)
+			continue
+		}
+
+		if utf8.RuneCountInString(key) > MaxKeyLen {
+			v.add(field, RuleKeyLength, "key is longer than %d characters", MaxKeyLen)
+			key = truncate(key, MaxKeyLen)
+			if _, ok := out[key]; ok {
+				v.add(field, RuleKeyLength, "key cut to %d characters collides with another tag", MaxKeyLen)
+				continue
+			}
+		}
+
+		if utf8.RuneCountInString(value) > MaxValueLen {
+			v.add(field, RuleValueLength, "value is longer than %d characters", MaxValueLen)
+			value = truncate(value, MaxValueLen)
+		}
+
+		out[key] = value
+	}
+
+	if len(out) > MaxTags {
+		v.add("tags", RuleTagCount, "has %d tags, at most %d are allowed", len(out), MaxTags)
+		out = limitTags(out, required)
+	}
+
+	if len(v) > 0 && !c.truncates() {
+		return tags, v, v
+	}
+	return out, v, nil
+}
+
+func (c *Checker) truncates() bool {
+	return c != nil && c.Mode == Truncate
+}
+
+// limitTags keeps the required tags then the others in key order
+func limitTags(tags map[string]string, required []string) map[string]string {
+	out := make(map[string]string, MaxTags)
+
+	for _, key := range required {
+		if value, ok := tags[key]; ok && len(out) < MaxTags {
+			out[key] = value
+		}
+	}
+
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if len(out) == MaxTags {
+			break
+		}
+		if _, ok := out[key]; !ok {
+			out[key] = tags[key]
+		}
+	}
+
+	return out
+}
+
+// truncate cuts s to n characters
+func truncate(s string, n int) string {
+	i := 0
+	for pos := range s {
+		if i == n {
+			return s[:pos]
+		}
+		i++
+	}
+	return s
+}
+
+// truncateLabel cuts label to n characters ending with a hash of label
+func truncateLabel(label string, n int) string {
+	head := strings.TrimRight(label[:n-hashLen-1], "-")
+	return head + "-" + labelHash(label)
+}
+
+// labelHash returns the hex characters ending a label cut from label
+func labelHash(label string) string {
+	sum := sha1.Sum([]byte(label))
+	return hex.EncodeToString(sum[:])[:hashLen]
+}
+
+func validLabelChars(label string) bool {
+	if label == "" {
+		return false
+	}
+	for i, r := range label {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+		case r == '-' && i > 0 && i < len(label)-1:
+		default:
+			return false
+		}
+	}
+	return true
+}
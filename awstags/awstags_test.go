@@ -0,0 +1,106 @@
+package awstags
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestHostnameTruncatesLongLabels(t *testing.T) {
+	long := "p-" + strings.Repeat("web", 25) + "-b-orange-1a"
+
+	if _, v, err := NewChecker(Reject).Hostname(long); err == nil || v[0].Rule != RuleLabelLength {
+		t.Fatalf("expected a long label to be rejected got %v", v)
+	}
+
+	c := NewChecker(Truncate)
+	a, v, err := c.Hostname(long)
+	if err != nil {
+		t.Fatalf("error was not expected while truncating: %s", err)
+	}
+	if len(a) != MaxLabelLen || len(v) != 1 {
+		t.Errorf("expected a %d character name and one violation got %s %v", MaxLabelLen, a, v)
+	}
+
+	again, _, _ := c.Hostname(long)
+	other, _, _ := c.Hostname(strings.Replace(long, "orange", "purple", 1))
+	if again != a || other == a {
+		t.Errorf("expected truncation to be deterministic and keep names distinct got %s %s %s", a, again, other)
+	}
+
+	if _, _, err := c.Hostname("p-Web-b-orange-1a"); err == nil {
+		t.Errorf("expected upper case to be rejected when truncating")
+	}
+
+	if name, v, err := c.Hostname("p-web-b-orange-1a"); err != nil || len(v) != 0 || name != "p-web-b-orange-1a" {
+		t.Errorf("expected a valid name to pass unchanged got %s %v %v", name, v, err)
+	}
+}
+
+func TestLabelShortensTheFlexiblePart(t *testing.T) {
+	parts := []string{"p", strings.Repeat("web", 25), "b", "orange", "1a"}
+
+	if _, v, err := NewChecker(Reject).Label(parts, 1); err == nil || v[0].Rule != RuleLabelLength {
+		t.Fatalf("expected a long label to be rejected got %v", v)
+	}
+
+	name, v, err := NewChecker(Truncate).Label(parts, 1)
+	if err != nil {
+		t.Fatalf("error was not expected while truncating: %s", err)
+	}
+	if len(name) > MaxLabelLen || len(v) != 1 {
+		t.Errorf("expected at most %d characters and one violation got %s %v", MaxLabelLen, name, v)
+	}
+	if !strings.HasPrefix(name, "p-web") || !strings.HasSuffix(name, "-b-orange-1a") {
+		t.Errorf("expected the role to be shortened and the rest kept got %s", name)
+	}
+
+	if name, _, _ := NewChecker(Truncate).Label([]string{"p", "web", "b", "orange", "1a"}, 1); name != "p-web-b-orange-1a" {
+		t.Errorf("expected a valid name to pass unchanged got %s", name)
+	}
+}
+
+func TestTagsLimits(t *testing.T) {
+	tags := map[string]string{
+		"Name":                   "p-web-b-orange-1a",
+		"aws:cloudformation":     "stack",
+		strings.Repeat("k", 130): "v",
+		"backup":                 strings.Repeat("v", 300),
+	}
+
+	if _, v, err := NewChecker(Reject).Tags(tags); err == nil || len(v) != 3 {
+		t.Errorf("expected 3 violations got %v", v)
+	}
+
+	out, v, err := NewChecker(Truncate).Tags(tags)
+	if err != nil {
+		t.Fatalf("error was not expected while truncating: %s", err)
+	}
+	if len(v) != 3 {
+		t.Errorf("expected 3 violations got %v", v)
+	}
+	if _, ok := out["aws:cloudformation"]; ok {
+		t.Errorf("expected the reserved tag to be dropped")
+	}
+	if len(out[strings.Repeat("k", MaxKeyLen)]) != 1 || len(out["backup"]) != MaxValueLen {
+		t.Errorf("expected the key and value to be cut got %v", out)
+	}
+}
+
+func TestTagsCountKeepsRequired(t *testing.T) {
+	tags := map[string]string{"zz-required": "yes"}
+	for i := 0; i < MaxTags+5; i++ {
+		tags[fmt.Sprintf("extra-%02d", i)] = "x"
+	}
+
+	out, v, err := NewChecker(Truncate).Tags(tags, "zz-required")
+	if err != nil || len(v) != 1 || v[0].Rule != RuleTagCount {
+		t.Fatalf("expected one tag count violation got %v %v", v, err)
+	}
+	if len(out) != MaxTags || out["zz-required"] != "yes" {
+		t.Errorf("expected %d tags keeping the required one got %d", MaxTags, len(out))
+	}
+	if _, ok := out["extra-00"]; !ok {
+		t.Errorf("expected the first extra tags in key order to be kept")
+	}
+}
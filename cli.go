@@ -0,0 +1,408 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mleone896/inventory/api"
+	"github.com/mleone896/inventory/client"
+	"github.com/mleone896/inventory/db"
+	"github.com/mleone896/inventory/models"
+)
+
+// DefaultServer is the api the client subcommands talk to
+const DefaultServer = "http://localhost:8080"
+
+// command is a subcommand of the binary
+type command struct {
+	args    string
+	summary string
+	run     func(args []string) error
+}
+
+// commands lists the subcommands by name, serve is run when none is given
+func commands() map[string]command {
+	return map[string]command{
+		"serve":        {"[flags]", "run the api and the sync jobs", serve},
+		"migrate":      {"[-down] [-file path]", "apply or drop the database schema", migrate},
+		"create-token": {"<name:role>", "create an api token and print it once", createToken},
+		"new-host":     {"--env --role --pool --subnet [flags]", "allocate a host", newHost},
+		"colors":       {"list [-state s] [-environment e] | summary [-environment e] | add <name>... | release <name>", "manage the palette", colors},
+		"host":         {"get <color>", "the tags of the host holding a color", host},
+		"sync":         {"now [job...]", "run the sync jobs now", syncNow},
+		"config":       {"print [flags]", "the effective serve configuration", config},
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: inventory <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+
+	cmds := commands()
+	names := make([]string, 0, len(cmds))
+	for name := range cmds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w := tabwriter.NewWriter(os.Stderr, 0, 4, 2, ' ', 0)
+	for _, name := range names {
+		fmt.Fprintf(w, "  inventory %s %s\t%s\n", name, cmds[name].args, cmds[name].summary)
+	}
+	w.Flush()
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "run inventory <command> -h for the flags of a command")
+}
+
+// clientConfig is the configuration every client subcommand shares
+type clientConfig struct {
+	server     string
+	token      string
+	timeout    time.Duration
+	retries    int
+	clientCert string
+	clientKey  string
+	caCert     string
+}
+
+// register adds the shared flags to fs, like every setting they can be set
+// from the environment, e.g. $INVENTORY_TOKEN, keeping tokens out of shell
+// history
+func (c *clientConfig) register(fs *flag.FlagSet) {
+	fs.StringVar(&c.server, "server", DefaultServer, "Base url of the inventory api")
+	fs.StringVar(&c.token, "token", "", "Bearer token")
+	fs.DurationVar(&c.timeout, "timeout", 30*time.Second, "Timeout of each request")
+	fs.IntVar(&c.retries, "retries", client.DefaultRetries, "How many times a failed request is retried")
+	fs.StringVar(&c.clientCert, "clientCert", "", "PEM client certificate for mtls auth")
+	fs.StringVar(&c.clientKey, "clientKey", "", "PEM key of -clientCert")
+	fs.StringVar(&c.caCert, "caCert", "", "PEM bundle the server certificate is verified with")
+}
+
+// client builds an api client from the shared flags
+func (c *clientConfig) client() (*client.Client, error) {
+	tlsConfig := &tls.Config{}
+
+	if c.clientCert != "" {
+		cert, err := tls.LoadX509KeyPair(c.clientCert, c.clientKey)
+		if err != nil {
+			return nil, fmt.Errorf("could not load -clientCert: %s", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if c.caCert != "" {
+		pem, err := ioutil.ReadFile(c.caCert)
+		if err != nil {
+			return nil, fmt.Errorf("could not read -caCert: %s", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in -caCert %s", c.caCert)
+		}
+	}
+
+	httpClient := &http.Client{
+		Timeout:   c.timeout,
+		Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: tlsConfig},
+	}
+
+	return client.New(c.server,
+		client.WithHTTPClient(httpClient),
+		client.WithToken(c.token),
+		client.WithRetries(c.retries),
+	)
+}
+
+// newFlagSet returns the flags of a client subcommand
+func newFlagSet(name string, cfg *clientConfig) *flag.FlagSet {
+	fs := flag.NewFlagSet("inventory "+name, flag.ExitOnError)
+	cfg.register(fs)
+	return fs
+}
+
+// printJSON writes v indented to stdout for people and scripts alike
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// migrate applies the schema, or drops it with -down
+func migrate(args []string) error {
+	fs := flag.NewFlagSet("inventory migrate", flag.ExitOnError)
+	conn := fs.String("connString", DefaultConnString, "The Database ConnectionString")
+	down := fs.Bool("down", false, "Drop the schema instead")
+	file := fs.String("file", "", "SQL file to run, defaults to "+db.DefaultUps+" or "+db.DefaultDowns)
+	if _, err := loadConfig(fs, args); err != nil {
+		return err
+	}
+
+	path := *file
+	if path == "" {
+		path = db.DefaultUps
+		if *down {
+			path = db.DefaultDowns
+		}
+	}
+
+	d, err := db.New(db.WithConnString(*conn))
+	if err != nil {
+		return err
+	}
+	defer d.Conn.Close()
+
+	if err := d.Migrate(path); err != nil {
+		return err
+	}
+
+	fmt.Printf("applied %s\n", path)
+	return nil
+}
+
+// createToken stores a new api token, the name and role are only taken from
+// the command line so no configuration can turn another command into this one
+func createToken(args []string) error {
+	fs := flag.NewFlagSet("inventory create-token", flag.ExitOnError)
+	conn := fs.String("connString", DefaultConnString, "The Database ConnectionString")
+	if _, err := loadConfig(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: inventory create-token <name:role>")
+	}
+
+	d, err := db.New(db.WithConnString(*conn))
+	if err != nil {
+		return err
+	}
+	defer d.Conn.Close()
+
+	return createAPIToken(d, fs.Arg(0))
+}
+
+// newHost allocates a host and prints its tags
+func newHost(args []string) error {
+	cfg := &clientConfig{}
+	req := &api.TagsRequest{}
+	fs := newFlagSet("new-host", cfg)
+	fs.StringVar(&req.Environment, "env", "", "Environment of the host")
+	fs.StringVar(&req.Role, "role", "", "Primary role of the host")
+	fs.StringVar(&req.Pool, "pool", "", "Pool of the host")
+	fs.StringVar(&req.SubnetID, "subnet", "", "Subnet the host is launched in")
+	fs.StringVar(&req.Color, "color", "", "Ask for a color")
+	fs.StringVar(&req.Owner, "owner", "", "Owner of the host")
+	fs.StringVar(&req.Replaces, "replaces", "", "Instance the host rebuilds, whose color may be taken back")
+	dryRun := fs.Bool("dry-run", false, "Preview the allocation without keeping it")
+	key := fs.String("idempotency-key", "", "Key a retried allocation is replayed by")
+	if _, err := loadConfig(fs, args); err != nil {
+		return err
+	}
+
+	missing := []string{}
+	for name, value := range map[string]string{"env": req.Environment, "role": req.Role, "pool": req.Pool, "subnet": req.SubnetID} {
+		if value == "" {
+			missing = append(missing, "--"+name)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("%s must be set", strings.Join(missing, ", "))
+	}
+
+	c, err := cfg.client()
+	if err != nil {
+		return err
+	}
+
+	opts := []client.RequestOption{}
+	if *dryRun {
+		opts = append(opts, client.DryRun())
+	}
+	if *key != "" {
+		opts = append(opts, client.WithIdempotencyKey(*key))
+	}
+
+	res, err := c.NewHost(context.Background(), req, opts...)
+	if err != nil {
+		return err
+	}
+	return printJSON(res)
+}
+
+// colors lists, counts, adds or releases palette colors
+func colors(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("expected list, summary, add or release")
+	}
+
+	cfg := &clientConfig{}
+	fs := newFlagSet("colors "+args[0], cfg)
+	state, environment := colorsFlags(fs, args[0])
+	if _, err := loadConfig(fs, args[1:]); err != nil {
+		return err
+	}
+
+	c, err := cfg.client()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	switch args[0] {
+	case "list":
+		opts := []client.RequestOption{client.Filter("state", *state)}
+		if *environment != "" {
+			opts = append(opts, client.Filter("environment", *environment))
+		}
+
+		res := []api.Color{}
+		for cursor := ""; ; {
+			page, next, err := c.ListColors(ctx, append(opts, client.Page(models.MaxPageLimit, cursor))...)
+			if err != nil {
+				return err
+			}
+			res = append(res, page...)
+			if next == "" {
+				break
+			}
+			cursor = next
+		}
+		return printJSON(res)
+	case "summary":
+		res, err := c.SummarizeColors(ctx, *environment)
+		if err != nil {
+			return err
+		}
+		return printJSON(res)
+	case "add":
+		if fs.NArg() == 0 {
+			return fmt.Errorf("expected the names to add")
+		}
+		res, err := c.AddColors(ctx, fs.Args())
+		if err != nil {
+			return err
+		}
+		return printJSON(res)
+	case "release":
+		if fs.NArg() != 1 {
+			return fmt.Errorf("expected the name to release")
+		}
+		res, err := c.ReleaseColor(ctx, fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		return printJSON(res)
+	}
+
+	return fmt.Errorf("unknown colors command %q, expected list, summary, add or release", args[0])
+}
+
+// colorsFlags registers the flags the colors subcommand sub reads, only list
+// and summary take a state or environment
+func colorsFlags(fs *flag.FlagSet, sub string) (*string, *string) {
+	state, environment := new(string), new(string)
+	switch sub {
+	case "list":
+		fs.StringVar(state, "state", models.ColorStateFree, "Colors to list: "+strings.Join(models.ColorStates, ", "))
+		fs.StringVar(environment, "environment", "", "Environment whose cooldown decides what is cooling down")
+	case "summary":
+		fs.StringVar(environment, "environment", "", "Environment whose cooldown decides what is cooling down")
+	}
+	return state, environment
+}
+
+// host prints the tags of the host holding a color
+func host(args []string) error {
+	if len(args) == 0 || args[0] != "get" {
+		return fmt.Errorf("expected get <color>")
+	}
+
+	cfg := &clientConfig{}
+	fs := newFlagSet("host get", cfg)
+	if _, err := loadConfig(fs, args[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("expected the color of the host")
+	}
+
+	c, err := cfg.client()
+	if err != nil {
+		return err
+	}
+
+	res, err := c.GetHost(context.Background(), fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	return printJSON(res)
+}
+
+// syncNow triggers the named sync jobs, every job when none is named
+func syncNow(args []string) error {
+	if len(args) == 0 || args[0] != "now" {
+		return fmt.Errorf("expected now [job...]")
+	}
+
+	cfg := &clientConfig{}
+	fs := newFlagSet("sync now", cfg)
+	if _, err := loadConfig(fs, args[1:]); err != nil {
+		return err
+	}
+
+	c, err := cfg.client()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	jobs := fs.Args()
+	if len(jobs) == 0 {
+		statuses, err := c.ListJobs(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			jobs = append(jobs, s.Name)
+		}
+	}
+
+	for _, job := range jobs {
+		if err := c.TriggerJob(ctx, job); err != nil {
+			return fmt.Errorf("could not trigger %s: %s", job, err)
+		}
+		fmt.Printf("triggered %s\n", job)
+	}
+	return nil
+}
+
+// config prints the configuration serve would run with, secrets redacted,
+// and fails if serve would refuse it
+func config(args []string) error {
+	if len(args) == 0 || args[0] != "print" {
+		return fmt.Errorf("expected print [flags]")
+	}
+
+	flag.CommandLine.Init("inventory config print", flag.ExitOnError)
+	c, err := loadConfig(flag.CommandLine, args[1:])
+	if err != nil {
+		return err
+	}
+	c.Print(os.Stdout)
+
+	if errs := validateServe(); len(errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n  %s", strings.Join(errs, "\n  "))
+	}
+	return nil
+}
@@ -0,0 +1,411 @@
+// Package client is a typed client of the inventory api, requests that are
+// safe to repeat are retried on network errors and transient statuses
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mleone896/inventory/api"
+)
+
+// the retry defaults
+const (
+	DefaultRetries    = 3
+	DefaultBackoff    = 200 * time.Millisecond
+	DefaultMaxBackoff = 5 * time.Second
+)
+
+// Client calls the inventory api
+type Client struct {
+	baseURL    *url.URL
+	http       *http.Client
+	token      string
+	retries    int
+	backoff    time.Duration
+	maxBackoff time.Duration
+}
+
+// Error is an error response of the api
+type Error struct {
+	StatusCode int
+	api.APIError
+}
+
+// Error ...
+func (e *Error) Error() string {
+	if e.Detail == "" {
+		return fmt.Sprintf("%d %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, e.Message, e.Detail)
+}
+
+// New returns a client of the api at baseURL, e.g. http://localhost:8080
+func New(baseURL string, opts ...func(*Client)) (*Client, error) {
+	u, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("could not parse base url: %s", err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("base url %q must be absolute", baseURL)
+	}
+
+	c := &Client{
+		baseURL:    u,
+		http:       &http.Client{Timeout: 30 * time.Second},
+		retries:    DefaultRetries,
+		backoff:    DefaultBackoff,
+		maxBackoff: DefaultMaxBackoff,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c, nil
+}
+
+// WithHTTPClient sets the http client requests are sent with, e.g. one
+// presenting a client certificate
+func WithHTTPClient(h *http.Client) func(*Client) {
+	return func(c *Client) {
+		c.http = h
+	}
+}
+
+// WithToken sets the bearer token requests are authenticated with
+func WithToken(token string) func(*Client) {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithRetries sets how many times a failed request is retried, 0 disables
+// retries
+func WithRetries(n int) func(*Client) {
+	return func(c *Client) {
+		c.retries = n
+	}
+}
+
+// WithBackoff sets the wait before the first retry, it doubles with every
+// attempt up to max
+func WithBackoff(initial, max time.Duration) func(*Client) {
+	return func(c *Client) {
+		c.backoff = initial
+		c.maxBackoff = max
+	}
+}
+
+// RequestOption changes a single request
+type RequestOption func(*http.Request)
+
+// DryRun previews an allocation without keeping it
+func DryRun() RequestOption {
+	return func(r *http.Request) {
+		q := r.URL.Query()
+		q.Set("dry_run", "true")
+		r.URL.RawQuery = q.Encode()
+	}
+}
+
+// WithIdempotencyKey sets the key an allocation is replayed by, allocations
+// get a random key shared by their retries when none is set
+func WithIdempotencyKey(key string) RequestOption {
+	return func(r *http.Request) {
+		r.Header.Set(api.IdempotencyKeyHeader, key)
+	}
+}
+
+// Page asks for up to limit items after cursor, the cursor a previous list
+// returned or empty for the first page
+func Page(limit int, cursor string) RequestOption {
+	return func(r *http.Request) {
+		q := r.URL.Query()
+		if limit > 0 {
+			q.Set("limit", strconv.Itoa(limit))
+		}
+		if cursor != "" {
+			q.Set("cursor", cursor)
+		}
+		r.URL.RawQuery = q.Encode()
+	}
+}
+
+// Sort orders a list by key, prefixed with - for descending
+func Sort(key string) RequestOption {
+	return func(r *http.Request) {
+		q := r.URL.Query()
+		q.Set("sort", key)
+		r.URL.RawQuery = q.Encode()
+	}
+}
+
+// Filter keeps the items of a list whose key equals value, e.g. role or
+// tag.team
+func Filter(key, value string) RequestOption {
+	return func(r *http.Request) {
+		q := r.URL.Query()
+		q.Set(key, value)
+		r.URL.RawQuery = q.Encode()
+	}
+}
+
+// NewHost allocates a color and name for a host
+func (c *Client) NewHost(ctx context.Context, req *api.TagsRequest, opts ...RequestOption) (*api.TagsResponse, error) {
+	res := &api.TagsResponse{}
+	opts = append([]RequestOption{idempotencyKey()}, opts...)
+	if err := c.do(ctx, "POST", "/v1/new_host", req, res, opts...); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// NewHosts allocates several hosts at once, if one can't be allocated none are
+func (c *Client) NewHosts(ctx context.Context, req *api.BulkTagsRequest, opts ...RequestOption) (*api.BulkTagsResponse, error) {
+	res := &api.BulkTagsResponse{}
+	opts = append([]RequestOption{idempotencyKey()}, opts...)
+	if err := c.do(ctx, "POST", "/v1/new_hosts", req, res, opts...); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// GetHost returns the tags of the host holding color
+func (c *Client) GetHost(ctx context.Context, color string) (*api.TagsRequest, error) {
+	res := &api.TagsRequest{}
+	if err := c.do(ctx, "GET", "/v1/host/"+url.PathEscape(color), nil, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// ListColors returns a page of the free colors, or those of a
+// Filter("state", ...), and the cursor of the next, empty on the last page
+func (c *Client) ListColors(ctx context.Context, opts ...RequestOption) ([]api.Color, string, error) {
+	res := []api.Color{}
+	header, err := c.send(ctx, "GET", "/v1/colors", nil, &res, opts...)
+	if err != nil {
+		return nil, "", err
+	}
+	return res, header.Get(api.NextCursorHeader), nil
+}
+
+// SummarizeColors counts the colors in each state under the cooldown of
+// environment, the default cooldown if empty
+func (c *Client) SummarizeColors(ctx context.Context, environment string) (*api.ColorSummary, error) {
+	res := &api.ColorSummary{}
+	path := "/v1/colors/summary"
+	if environment != "" {
+		path += "?environment=" + url.QueryEscape(environment)
+	}
+	if err := c.do(ctx, "GET", path, nil, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// ListHosts returns a page of the synced instances and the cursor of the next
+func (c *Client) ListHosts(ctx context.Context, opts ...RequestOption) ([]api.Host, string, error) {
+	res := []api.Host{}
+	header, err := c.send(ctx, "GET", "/v1/hosts", nil, &res, opts...)
+	if err != nil {
+		return nil, "", err
+	}
+	return res, header.Get(api.NextCursorHeader), nil
+}
+
+// ListSubnets returns a page of the synced subnets and the cursor of the next
+func (c *Client) ListSubnets(ctx context.Context, opts ...RequestOption) ([]api.Subnet, string, error) {
+	res := []api.Subnet{}
+	header, err := c.send(ctx, "GET", "/v1/subnets", nil, &res, opts...)
+	if err != nil {
+		return nil, "", err
+	}
+	return res, header.Get(api.NextCursorHeader), nil
+}
+
+// AddColors adds names to the palette, names already in it are skipped
+func (c *Client) AddColors(ctx context.Context, names []string) (*api.ColorsResponse, error) {
+	res := &api.ColorsResponse{}
+	if err := c.do(ctx, "POST", "/v1/colors", &api.ColorsRequest{Names: names}, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// RetireColor removes a color no instance holds from the palette
+func (c *Client) RetireColor(ctx context.Context, name string) error {
+	return c.do(ctx, "DELETE", "/v1/colors/"+url.PathEscape(name), nil, nil)
+}
+
+// ReleaseColor frees a color no instance carries
+func (c *Client) ReleaseColor(ctx context.Context, name string) (*api.Color, error) {
+	res := &api.Color{}
+	if err := c.do(ctx, "POST", "/v1/colors/"+url.PathEscape(name)+"/release", nil, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// BlockColor blocks or unblocks a color
+func (c *Client) BlockColor(ctx context.Context, name string, blocked bool, reason string) (*api.Color, error) {
+	res := &api.Color{}
+	patch := &api.ColorPatch{Blocked: &blocked, Reason: reason}
+	if err := c.do(ctx, "PATCH", "/v1/colors/"+url.PathEscape(name), patch, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// ColorHistory returns every host that has held a color
+func (c *Client) ColorHistory(ctx context.Context, name string) ([]api.ColorAssignment, error) {
+	res := []api.ColorAssignment{}
+	if err := c.do(ctx, "GET", "/v1/colors/"+url.PathEscape(name)+"/history", nil, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// ListJobs returns the background jobs and their last run
+func (c *Client) ListJobs(ctx context.Context) ([]api.JobStatus, error) {
+	res := []api.JobStatus{}
+	if err := c.do(ctx, "GET", "/v1/jobs", nil, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// TriggerJob starts a run of a job now
+func (c *Client) TriggerJob(ctx context.Context, name string) error {
+	return c.do(ctx, "POST", "/v1/jobs/"+url.PathEscape(name)+"/trigger", nil, nil)
+}
+
+// idempotencyKey sets a random key so retried allocations are not repeated
+func idempotencyKey() RequestOption {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return WithIdempotencyKey(hex.EncodeToString(b))
+}
+
+// do sends the request, retrying it when that is safe, and decodes the
+// response into out
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}, opts ...RequestOption) error {
+	_, err := c.send(ctx, method, path, in, out, opts...)
+	return err
+}
+
+// send is do returning the headers of the response
+func (c *Client) send(ctx context.Context, method, path string, in, out interface{}, opts ...RequestOption) (http.Header, error) {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return nil, fmt.Errorf("could not marshal request: %s", err)
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest(method, c.baseURL.String()+path, bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("could not build request: %s", err)
+		}
+		req = req.WithContext(ctx)
+		req.Header.Set("Accept", "application/json")
+		if in != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+		for _, opt := range opts {
+			opt(req)
+		}
+
+		res, err := c.http.Do(req)
+		last := attempt >= c.retries || !c.repeatable(req)
+		if err == nil && (last || !retryable(res)) {
+			return res.Header, decode(res, out)
+		}
+		if err != nil && (last || ctx.Err() != nil) {
+			return nil, fmt.Errorf("could not %s %s: %s", method, path, err)
+		}
+
+		wait := c.wait(attempt, res)
+		if res != nil {
+			io.Copy(ioutil.Discard, res.Body)
+			res.Body.Close()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// repeatable reports whether sending req again can't have a different effect
+func (c *Client) repeatable(req *http.Request) bool {
+	return req.Method != "POST" || req.Header.Get(api.IdempotencyKeyHeader) != ""
+}
+
+// wait is the backoff before the next attempt, a Retry-After in seconds is
+// honored
+func (c *Client) wait(attempt int, res *http.Response) time.Duration {
+	if res != nil {
+		if s, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil && s >= 0 {
+			return time.Duration(s) * time.Second
+		}
+	}
+
+	d := c.backoff << uint(attempt)
+	if d > c.maxBackoff || d <= 0 {
+		d = c.maxBackoff
+	}
+	return d
+}
+
+// retryable responses are the ones a later attempt may not get, a conflict
+// with a Retry-After is a keyed request still being served
+func retryable(res *http.Response) bool {
+	switch res.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	case http.StatusConflict:
+		return res.Header.Get("Retry-After") != ""
+	}
+	return false
+}
+
+func decode(res *http.Response, out interface{}) error {
+	defer res.Body.Close()
+
+	if res.StatusCode >= http.StatusBadRequest {
+		apiErr := &Error{StatusCode: res.StatusCode}
+		if err := json.NewDecoder(res.Body).Decode(&apiErr.APIError); err != nil || apiErr.Message == "" {
+			apiErr.Message = http.StatusText(res.StatusCode)
+		}
+		return apiErr
+	}
+
+	if out == nil || res.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return fmt.Errorf("could not decode response: %s", err)
+	}
+	return nil
+}
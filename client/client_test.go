@@ -0,0 +1,163 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mleone896/inventory/api"
+)
+
+func testClient(t *testing.T, h http.HandlerFunc) *Client {
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	c, err := New(srv.URL, WithToken("secret"), WithBackoff(time.Millisecond, 5*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// writeError answers as the server does when a request fails
+func writeError(w http.ResponseWriter, status int, message, detail string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(api.APIError{Code: status, Message: message, Detail: detail})
+}
+
+func TestNewHostRetriesWithTheSameKey(t *testing.T) {
+	keys := []string{}
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get(api.IdempotencyKeyHeader))
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("expected the bearer token got %q", r.Header.Get("Authorization"))
+		}
+		if r.URL.Query().Get("dry_run") != "true" {
+			t.Errorf("expected a dry run got %q", r.URL.RawQuery)
+		}
+		if len(keys) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(api.TagsResponse{TagsRequest: api.TagsRequest{Name: "p-web-b-orange-1a", Color: "orange"}})
+	})
+
+	res, err := c.NewHost(context.Background(), &api.TagsRequest{Role: "web"}, DryRun())
+	if err != nil {
+		t.Fatalf("error was not expected while allocating: %s", err)
+	}
+	if res.Color != "orange" {
+		t.Errorf("expected orange got %s", res.Color)
+	}
+
+	if len(keys) != 3 || keys[0] == "" || keys[0] != keys[1] || keys[1] != keys[2] {
+		t.Errorf("expected 3 attempts sharing one idempotency key got %v", keys)
+	}
+}
+
+func TestPostWithoutKeyIsNotRetried(t *testing.T) {
+	calls := 0
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		writeError(w, http.StatusServiceUnavailable, "palette exhausted", "no free colors")
+	})
+
+	_, err := c.AddColors(context.Background(), []string{"orange"})
+	apiErr, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("expected an api error got %v", err)
+	}
+	if apiErr.StatusCode != http.StatusServiceUnavailable || apiErr.Message != "palette exhausted" {
+		t.Errorf("expected the decoded error got %+v", apiErr)
+	}
+	if calls != 1 {
+		t.Errorf("expected a single attempt got %d", calls)
+	}
+}
+
+func TestInFlightConflictIsRetried(t *testing.T) {
+	calls := 0
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.Header().Set("Retry-After", "0")
+			writeError(w, http.StatusConflict, "a request with this idempotency key is in progress", "k1")
+			return
+		}
+		json.NewEncoder(w).Encode(api.TagsResponse{TagsRequest: api.TagsRequest{Color: "orange"}})
+	})
+
+	res, err := c.NewHost(context.Background(), &api.TagsRequest{Role: "web"})
+	if err != nil {
+		t.Fatalf("error was not expected while allocating: %s", err)
+	}
+	if res.Color != "orange" || calls != 2 {
+		t.Errorf("expected orange after 2 attempts got %s after %d", res.Color, calls)
+	}
+
+	// a conflict the server does not ask to retry is final
+	calls = 0
+	c = testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		writeError(w, http.StatusConflict, "color in use", "orange")
+	})
+	if _, err := c.NewHost(context.Background(), &api.TagsRequest{Role: "web"}); err == nil || calls != 1 {
+		t.Errorf("expected a single failed attempt got %v after %d", err, calls)
+	}
+}
+
+func TestGetIsRetriedUntilExhausted(t *testing.T) {
+	calls := 0
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	if _, _, err := c.ListColors(context.Background()); err == nil {
+		t.Fatalf("expected an error")
+	}
+	if calls != DefaultRetries+1 {
+		t.Errorf("expected %d attempts got %d", DefaultRetries+1, calls)
+	}
+}
+
+func TestListPages(t *testing.T) {
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("limit") != "1" || q.Get("sort") != "-subnet_id" || q.Get("tag.team") != "web" {
+			t.Errorf("unexpected query %s", r.URL.RawQuery)
+		}
+		if q.Get("cursor") == "" {
+			w.Header().Set(api.NextCursorHeader, "abc")
+			w.Write([]byte(`[{"subnet_id": "subnet-2"}]`))
+			return
+		}
+		w.Write([]byte(`[{"subnet_id": "subnet-1"}]`))
+	})
+
+	opts := []RequestOption{Sort("-subnet_id"), Filter("tag.team", "web")}
+	ids := []string{}
+	cursor := ""
+	for {
+		subnets, next, err := c.ListSubnets(context.Background(), append(opts, Page(1, cursor))...)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		for _, s := range subnets {
+			ids = append(ids, s.SubnetID)
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	if strings.Join(ids, ",") != "subnet-2,subnet-1" {
+		t.Errorf("unexpected subnets %v", ids)
+	}
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/mleone896/inventory/auth"
+	"github.com/mleone896/inventory/awstags"
+	"github.com/mleone896/inventory/logging"
+	"github.com/mleone896/inventory/models"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// EnvPrefix starts the environment variables configuration is read from,
+// e.g. INVENTORY_CONN_STRING sets -connString
+const EnvPrefix = "INVENTORY_"
+
+// where a setting's value came from, later sources override earlier ones
+const (
+	sourceDefault = "default"
+	sourceFile    = "file"
+	sourceEnv     = "env"
+	sourceFlag    = "flag"
+)
+
+// secretFlags are never printed, connString only has its password hidden
+var secretFlags = map[string]bool{"token": true}
+
+// redacted replaces secrets when the configuration is printed
+const redacted = "REDACTED"
+
+// Config is the effective configuration of a command: its flags after the
+// config file, the environment and the command line were applied
+type Config struct {
+	fs      *flag.FlagSet
+	path    string
+	sources map[string]string
+}
+
+// loadConfig parses args into fs, settings not given as flags are taken from
+// the environment or, failing that, the yaml file named by -config or
+// $INVENTORY_CONFIG. The file's keys are flag names, one file can hold the
+// settings of every command
+func loadConfig(fs *flag.FlagSet, args []string) (*Config, error) {
+	path := fs.String("config", "", "YAML file of settings keyed by flag name, defaults to $"+envName("config"))
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	c := &Config{fs: fs, path: *path, sources: make(map[string]string)}
+
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+		c.sources[f.Name] = sourceFlag
+	})
+
+	if c.path == "" {
+		c.path = os.Getenv(envName("config"))
+	}
+
+	errs := []string{}
+	if c.path != "" {
+		settings, err := readConfigFile(c.path)
+		if err != nil {
+			return nil, err
+		}
+
+		keys := make([]string, 0, len(settings))
+		for key := range settings {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			if fs.Lookup(key) == nil || key == "config" {
+				if !knownSetting(key) {
+					errs = append(errs, fmt.Sprintf("%s: unknown setting %q", c.path, key))
+				}
+				continue
+			}
+			if explicit[key] {
+				continue
+			}
+			if err := fs.Set(key, settings[key]); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %s: %s", c.path, key, err))
+				continue
+			}
+			c.sources[key] = sourceFile
+		}
+	}
+
+	fs.VisitAll(func(f *flag.Flag) {
+		value, ok := os.LookupEnv(envName(f.Name))
+		if !ok || explicit[f.Name] || f.Name == "config" {
+			return
+		}
+		if err := fs.Set(f.Name, value); err != nil {
+			errs = append(errs, fmt.Sprintf("$%s: %s", envName(f.Name), err))
+			return
+		}
+		c.sources[f.Name] = sourceEnv
+	})
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid configuration:\n  %s", strings.Join(errs, "\n  "))
+	}
+	return c, nil
+}
+
+// knownSetting reports whether any command has a flag named key
+func knownSetting(key string) bool {
+	if flag.CommandLine.Lookup(key) != nil {
+		return true
+	}
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	(&clientConfig{}).register(fs)
+	colorsFlags(fs, "list")
+	return fs.Lookup(key) != nil
+}
+
+// readConfigFile reads a yaml file into flag values, lists are joined with
+// commas and maps written as key=value pairs, the forms flags like -auth and
+// -cooldowns take
+func readConfigFile(path string) (map[string]string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read config file: %s", err)
+	}
+
+	raw := make(map[string]interface{})
+	if err := yaml.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("could not parse config file %s: %s", path, err)
+	}
+
+	settings := make(map[string]string, len(raw))
+	for key, value := range raw {
+		settings[key] = flagValue(value)
+	}
+	return settings, nil
+}
+
+func flagValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case []interface{}:
+		parts := make([]string, len(v))
+		for i, e := range v {
+			parts[i] = flagValue(e)
+		}
+		return strings.Join(parts, ",")
+	case map[interface{}]interface{}:
+		parts := make([]string, 0, len(v))
+		for k, e := range v {
+			parts = append(parts, flagValue(k)+"="+flagValue(e))
+		}
+		sort.Strings(parts)
+		return strings.Join(parts, ",")
+	}
+	return fmt.Sprint(v)
+}
+
+// envName is the environment variable of a flag, e.g. connString is
+// INVENTORY_CONN_STRING and oidcJWKS INVENTORY_OIDC_JWKS
+func envName(flagName string) string {
+	var b strings.Builder
+	b.WriteString(EnvPrefix)
+	prev := rune(0)
+	for _, r := range flagName {
+		if unicode.IsUpper(r) && (unicode.IsLower(prev) || unicode.IsDigit(prev)) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+		prev = r
+	}
+	return b.String()
+}
+
+// Print writes the effective configuration as yaml usable as a config file,
+// each setting commented with where its value came from
+func (c *Config) Print(w io.Writer) {
+	if c.path != "" {
+		fmt.Fprintf(w, "# config file: %s\n", c.path)
+	}
+
+	c.fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == "config" {
+			return
+		}
+		source, ok := c.sources[f.Name]
+		if !ok {
+			source = sourceDefault
+		}
+		fmt.Fprintf(w, "%s: %s # %s, $%s\n", f.Name, strconv.Quote(redact(f.Name, f.Value.String())), source, envName(f.Name))
+	})
+}
+
+var passwordPattern = regexp.MustCompile(`(password=)('[^']*'|\S+)`)
+
+// redact hides secrets and the password of a connection string
+func redact(name, value string) string {
+	if value == "" {
+		return value
+	}
+	if secretFlags[name] {
+		return redacted
+	}
+	if name != "connString" {
+		return value
+	}
+
+	if u, err := url.Parse(value); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+			return u.String()
+		}
+		return value
+	}
+	return passwordPattern.ReplaceAllString(value, "${1}"+redacted)
+}
+
+// accountPattern matches an aws account id
+var accountPattern = regexp.MustCompile(`^[0-9]{12}$`)
+
+// validateServe checks every setting of serve and returns all the problems
+// found, so a bad deploy fails on startup rather than on first use
+func validateServe() []string {
+	errs := []string{}
+	check := func(name string, err error) {
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("-%s: %s", name, err))
+		}
+	}
+
+	if !accountPattern.MatchString(account) {
+		errs = append(errs, fmt.Sprintf("-account: %q must be a 12 digit aws account id", account))
+	}
+	if region == "" {
+		errs = append(errs, "-region: must be set")
+	}
+	if pollInterval < 1 {
+		errs = append(errs, "-pollInterval: must be at least 1 second")
+	}
+	if (tlsCert == "") != (tlsKey == "") {
+		errs = append(errs, "-tlsCert and -tlsKey must be set together")
+	}
+
+	_, err := logging.ParseLevel(logLevel)
+	check("logLevel", err)
+	_, err = models.ParseCooldown(cooldown)
+	check("cooldown", err)
+	_, err = models.ParseCooldowns(cooldowns)
+	check("cooldowns", err)
+	_, err = models.ParseFallback(paletteFallback)
+	check("paletteFallback", err)
+	_, err = models.NewPalettePolicy(models.FallbackNone, nil, paletteLowWater)
+	check("paletteLowWater", err)
+	_, err = models.ParseStrategy(colorStrategy)
+	check("colorStrategy", err)
+	_, err = models.ParseOwnerPrecedence(ownerPrecedence)
+	check("ownerPrecedence", err)
+	_, err = awstags.ParseMode(tagLimits)
+	check("tagLimits", err)
+	_, err = auth.ParseRoleMap(certRoles)
+	check("certRoles", err)
+	if certDefaultRole != "" {
+		_, err = auth.ParseRole(certDefaultRole)
+		check("certDefaultRole", err)
+	}
+
+	for _, method := range strings.Split(authMethods, ",") {
+		switch strings.TrimSpace(method) {
+		case "", "none", "token":
+		case "mtls":
+			if clientCA == "" {
+				errs = append(errs, "-auth: mtls auth requires -clientCA")
+			}
+		case "oidc":
+			if oidcIssuer == "" || oidcAudience == "" || oidcJWKS == "" {
+				errs = append(errs, "-auth: oidc auth requires -oidcIssuer, -oidcAudience and -oidcJWKS")
+			}
+		default:
+			errs = append(errs, fmt.Sprintf("-auth: unknown auth method %q", method))
+		}
+	}
+
+	if fallbackWords != "" {
+		_, err = models.ReadWordList(fallbackWords)
+		check("fallbackWords", err)
+	}
+	if tagPolicy != "" {
+		_, err = models.LoadTagPolicy(tagPolicy)
+		check("tagPolicy", err)
+	}
+	if clientCA != "" {
+		_, err = os.Stat(clientCA)
+		check("clientCA", err)
+	}
+
+	sort.Strings(errs)
+	return errs
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEnvName(t *testing.T) {
+	for flagName, want := range map[string]string{
+		"port":              "INVENTORY_PORT",
+		"connString":        "INVENTORY_CONN_STRING",
+		"clientCA":          "INVENTORY_CLIENT_CA",
+		"oidcJWKS":          "INVENTORY_OIDC_JWKS",
+		"idempotencyWindow": "INVENTORY_IDEMPOTENCY_WINDOW",
+	} {
+		if got := envName(flagName); got != want {
+			t.Errorf("envName(%q) = %q, want %q", flagName, got, want)
+		}
+	}
+}
+
+func testFlags() (*flag.FlagSet, map[string]*string) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	values := map[string]*string{}
+	for _, name := range []string{"port", "region", "logLevel", "auth", "cooldowns"} {
+		values[name] = fs.String(name, "default", "")
+	}
+	return fs, values
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "inventory.yaml")
+	file := "port: :9090\nregion: eu-west-1\nlogLevel: warn\nauth: [token, mtls]\ncooldowns: {prod: 30d, dev: 0s}\n"
+	if err := ioutil.WriteFile(path, []byte(file), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("INVENTORY_REGION", "us-west-2")
+	os.Setenv("INVENTORY_LOG_LEVEL", "error")
+	defer os.Unsetenv("INVENTORY_REGION")
+	defer os.Unsetenv("INVENTORY_LOG_LEVEL")
+
+	fs, values := testFlags()
+	c, err := loadConfig(fs, []string{"-config", path, "-logLevel", "debug"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := map[string]string{
+		"port":      ":9090",
+		"region":    "us-west-2",
+		"logLevel":  "debug",
+		"auth":      "token,mtls",
+		"cooldowns": "dev=0s,prod=30d",
+	}
+	for name, value := range want {
+		if *values[name] != value {
+			t.Errorf("%s = %q, want %q", name, *values[name], value)
+		}
+	}
+
+	sources := map[string]string{"port": sourceFile, "region": sourceEnv, "logLevel": sourceFlag}
+	for name, source := range sources {
+		if c.sources[name] != source {
+			t.Errorf("source of %s = %q, want %q", name, c.sources[name], source)
+		}
+	}
+}
+
+func TestLoadConfigUnknownSetting(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "inventory.yaml")
+	if err := ioutil.WriteFile(path, []byte("prot: :9090\nserver: http://inventory\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	fs, _ := testFlags()
+	_, err = loadConfig(fs, []string{"-config", path})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if !strings.Contains(err.Error(), `"prot"`) || strings.Contains(err.Error(), `"server"`) {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name, value, want string
+	}{
+		{"token", "abc", redacted},
+		{"token", "", ""},
+		{"port", ":8080", ":8080"},
+		{"connString", "dbname=inventory sslmode=disable", "dbname=inventory sslmode=disable"},
+		{"connString", "dbname=inventory password=hunter2 sslmode=disable", "dbname=inventory password=REDACTED sslmode=disable"},
+		{"connString", "dbname=inventory password='hunter 2'", "dbname=inventory password=REDACTED"},
+		{"connString", "postgres://inventory:hunter2@db/inventory", "postgres://inventory:REDACTED@db/inventory"},
+		{"connString", "postgres://inventory@db/inventory", "postgres://inventory@db/inventory"},
+	}
+
+	for _, tt := range tests {
+		if got := redact(tt.name, tt.value); got != tt.want {
+			t.Errorf("redact(%q, %q) = %q, want %q", tt.name, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestConfigPrint(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("token", "", "")
+	fs.String("port", ":8080", "")
+
+	c, err := loadConfig(fs, []string{"-token", "secret"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var b bytes.Buffer
+	c.Print(&b)
+
+	if strings.Contains(b.String(), "secret") {
+		t.Errorf("token printed: %s", b.String())
+	}
+	for _, line := range []string{
+		`port: ":8080" # default, $INVENTORY_PORT`,
+		`token: "REDACTED" # flag, $INVENTORY_TOKEN`,
+	} {
+		if !strings.Contains(b.String(), line) {
+			t.Errorf("expected %q in:\n%s", line, b.String())
+		}
+	}
+}
@@ -2,31 +2,45 @@ package db
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/mleone896/inventory/logging"
+	"github.com/mleone896/inventory/tracing"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Find takes anything that knows how to get and propogrates the error up the
 // call stack
 func (d *DataObj) Read(q Getter) error {
+	finish := d.trace("read", q)
 
 	err := q.Get(d.Conn)
 	if err != nil {
-		return fmt.Errorf("could not find from queryer: %v", err)
+		err = fmt.Errorf("could not find from queryer: %w", err)
 	}
 
+	finish(err)
 	return err
 }
 
 // FindAll ...
 func (d *DataObj) FindAll(f SelectAller) (*sqlx.Rows, error) {
-	return f.FindAll(d.Conn)
+	finish := d.trace("find_all", f)
+
+	rows, err := f.FindAll(d.Conn)
+
+	finish(err)
+	return rows, err
 }
 
 // Create ...
 func (d *DataObj) Create(c Inserter) (string, error) {
+	finish := d.trace("create", c)
+
 	// create the thing and capture the id
 	id, err := c.Create(d.Conn)
+	finish(err)
 	if err != nil {
 		return "", err
 	}
@@ -35,24 +49,60 @@ func (d *DataObj) Create(c Inserter) (string, error) {
 
 // Update ....
 func (d *DataObj) Update(u Updater) error {
-	if err := u.Update(d.Conn); err != nil {
-		return err
-	}
+	finish := d.trace("update", u)
+
+	err := u.Update(d.Conn)
+	finish(err)
 
-	return nil
+	return err
 }
 
 // Delete ...
 func (d *DataObj) Delete(de Deleter) error {
+	finish := d.trace("delete", de)
 
-	if err := de.Delete(d.Conn); err != nil {
-		return err
-	}
-	return nil
+	err := de.Delete(d.Conn)
+	finish(err)
 
+	return err
 }
 
 // UpdateAll accepts a function that runs a transactional update on all rows
 func (d *DataObj) UpdateAll(fn ExecFun) error {
-	return fn(d.Conn)
+	finish := d.trace("update_all", fn)
+
+	err := fn(d.Conn)
+	finish(err)
+
+	return err
+}
+
+// trace opens a span for the operation and returns the func that closes it
+// and logs the outcome at debug level tagged with the bound request id
+func (d *DataObj) trace(op string, obj interface{}) func(error) {
+	start := time.Now()
+	object := fmt.Sprintf("%T", obj)
+
+	_, span := tracing.Start(d.Context(), "db."+op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			tracing.String("db.system", "postgresql"),
+			tracing.String("db.operation", op),
+			tracing.String("db.object", object),
+		),
+	)
+
+	return func(err error) {
+		tracing.End(span, err)
+
+		fields := logging.FromContext(d.ctx)
+		fields["db_op"] = op
+		fields["object"] = object
+		fields["duration_ms"] = float64(time.Since(start)) / float64(time.Millisecond)
+		if err != nil {
+			fields["error"] = err
+		}
+
+		logging.Default().Debug("db operation", fields)
+	}
 }
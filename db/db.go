@@ -1,6 +1,7 @@
 package db
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"strings"
@@ -60,6 +61,7 @@ type DBer interface {
 type DataObj struct {
 	connString string
 	Conn       *sqlx.DB
+	ctx        context.Context
 }
 
 // needed to pick the random color
@@ -100,6 +102,22 @@ func WithConnString(s string) ConfigFunc {
 	}
 }
 
+// WithContext returns a shallow copy of the data object whose operations are
+// logged with the request id carried by ctx
+func (d *DataObj) WithContext(ctx context.Context) *DataObj {
+	cp := *d
+	cp.ctx = ctx
+	return &cp
+}
+
+// Context returns the context the data object was bound to
+func (d *DataObj) Context() context.Context {
+	if d.ctx == nil {
+		return context.Background()
+	}
+	return d.ctx
+}
+
 // TxRollbackHandleError takes a sqlx Transaction and tries to roll it back
 // if that doesn't succeed it returns that error, if it does it returns the
 // error that was produced from the Exec
@@ -0,0 +1,32 @@
+package db
+
+import (
+	"fmt"
+	"io/ioutil"
+)
+
+// DefaultUps and DefaultDowns are the schema files relative to the repo root
+const (
+	DefaultUps   = "config/psql/ups.pgsql"
+	DefaultDowns = "config/psql/downs.pgsql"
+)
+
+// Migrate runs the statements of the sql file at path in one transaction,
+// the ups are written to be run again against an existing schema
+func (d *DataObj) Migrate(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read migration: %s", err)
+	}
+
+	tx, err := d.Conn.BeginTxx(d.Context(), nil)
+	if err != nil {
+		return fmt.Errorf("could not get tx handler: %s", err)
+	}
+
+	if _, err := tx.ExecContext(d.Context(), string(b)); err != nil {
+		return TxRollbackHandleError(tx, fmt.Errorf("could not run migration %s: %s", path, err))
+	}
+
+	return TxCommitHandleError(tx)
+}
@@ -0,0 +1,203 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a log line
+type Level int
+
+// the levels a Logger knows how to write, in increasing severity
+const (
+	Debug Level = iota
+	Info
+	Warn
+	Error
+)
+
+var levelNames = map[Level]string{
+	Debug: "debug",
+	Info:  "info",
+	Warn:  "warn",
+	Error: "error",
+}
+
+// String ...
+func (l Level) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+// ParseLevel turns debug, info, warn or error into a Level
+func ParseLevel(s string) (Level, error) {
+	for level, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return level, nil
+		}
+	}
+	return Info, fmt.Errorf("unknown log level %q", s)
+}
+
+// Fields are the structured key values attached to a log line
+type Fields map[string]interface{}
+
+// Logger writes leveled json lines
+type Logger struct {
+	mu    sync.Mutex
+	out   io.Writer
+	level Level
+}
+
+// ConfigFunc allows caller to set config options on a Logger
+type ConfigFunc func(*Logger)
+
+// New returns a logger writing info and above to stderr unless configured
+func New(opts ...ConfigFunc) *Logger {
+	l := &Logger{out: os.Stderr, level: Info}
+
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	return l
+}
+
+// WithOutput sets where log lines are written
+func WithOutput(w io.Writer) ConfigFunc {
+	return func(l *Logger) {
+		l.out = w
+	}
+}
+
+// WithLevel sets the minimum level that is written
+func WithLevel(level Level) ConfigFunc {
+	return func(l *Logger) {
+		l.level = level
+	}
+}
+
+// SetLevel changes the minimum level that is written
+func (l *Logger) SetLevel(level Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.level = level
+}
+
+// Log writes msg and fields as a single json line if level is enabled
+func (l *Logger) Log(level Level, msg string, fields Fields) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if level < l.level {
+		return
+	}
+
+	line := make(map[string]interface{}, len(fields)+3)
+	for k, v := range fields {
+		// errors marshal to {} so flatten them to their message
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		line[k] = v
+	}
+	line["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+	line["level"] = level.String()
+	line["msg"] = msg
+
+	b, err := json.Marshal(line)
+	if err != nil {
+		b = []byte(fmt.Sprintf(`{"level":"error","msg":"could not marshal log line: %s"}`, err))
+	}
+
+	l.out.Write(append(b, '\n'))
+}
+
+// Debug ...
+func (l *Logger) Debug(msg string, fields Fields) { l.Log(Debug, msg, fields) }
+
+// Info ...
+func (l *Logger) Info(msg string, fields Fields) { l.Log(Info, msg, fields) }
+
+// Warn ...
+func (l *Logger) Warn(msg string, fields Fields) { l.Log(Warn, msg, fields) }
+
+// Error ...
+func (l *Logger) Error(msg string, fields Fields) { l.Log(Error, msg, fields) }
+
+// std is the process wide logger used by the package level helpers
+var std = New()
+
+// Default returns the process wide logger
+func Default() *Logger {
+	return std
+}
+
+// RequestIDHeader is the header used to accept and return correlation ids
+const RequestIDHeader = "X-Request-ID"
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	callerKey
+)
+
+// NewRequestID returns a random 128 bit hex id
+func NewRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// WithRequestID returns a copy of ctx carrying the request id
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID returns the request id stored in ctx or an empty string
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// WithCaller returns a copy of ctx carrying the identity of the caller
+func WithCaller(ctx context.Context, caller string) context.Context {
+	return context.WithValue(ctx, callerKey, caller)
+}
+
+// Caller returns the caller identity stored in ctx or an empty string
+func Caller(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	caller, _ := ctx.Value(callerKey).(string)
+	return caller
+}
+
+// FromContext returns fields identifying the request carried by ctx
+func FromContext(ctx context.Context) Fields {
+	fields := Fields{}
+	if id := RequestID(ctx); id != "" {
+		fields["request_id"] = id
+	}
+	if caller := Caller(ctx); caller != "" {
+		fields["caller"] = caller
+	}
+	return fields
+}
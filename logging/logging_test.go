@@ -0,0 +1,54 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestLoggerFiltersByLevel(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := New(WithOutput(buf), WithLevel(Warn))
+
+	l.Info("dropped", nil)
+	l.Error("kept", Fields{"err": fmt.Errorf("boom")})
+
+	var line map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("expected a single json line got: %q", buf.String())
+	}
+
+	if line["msg"] != "kept" || line["level"] != "error" {
+		t.Errorf("unexpected log line: %v", line)
+	}
+
+	if line["err"] != "boom" {
+		t.Errorf("expected errors to be flattened to their message got: %v", line["err"])
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	level, err := ParseLevel("DEBUG")
+	if err != nil || level != Debug {
+		t.Errorf("expected debug got: %v %v", level, err)
+	}
+
+	if _, err := ParseLevel("loud"); err == nil {
+		t.Errorf("expected error for unknown level")
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	ctx := WithCaller(WithRequestID(context.Background(), "abc123"), "ci-bot")
+
+	fields := FromContext(ctx)
+	if fields["request_id"] != "abc123" || fields["caller"] != "ci-bot" {
+		t.Errorf("unexpected context fields: %v", fields)
+	}
+
+	if len(FromContext(context.Background())) != 0 {
+		t.Errorf("expected no fields for a bare context")
+	}
+}
@@ -1,14 +1,23 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"log"
-	"net/http"
+	"os"
+	"strings"
 	"time"
 
+	"github.com/mleone896/inventory/auth"
+	"github.com/mleone896/inventory/awstags"
 	"github.com/mleone896/inventory/db"
+	"github.com/mleone896/inventory/logging"
+	"github.com/mleone896/inventory/metrics"
+	"github.com/mleone896/inventory/models"
 	"github.com/mleone896/inventory/runners"
 	"github.com/mleone896/inventory/server"
+	"github.com/mleone896/inventory/tracing"
 )
 
 // DefaultPollInterval ...
@@ -16,8 +25,10 @@ const (
 	DefaultPollInterval = 60
 	DefaultPort         = ":8080"
 	DefaultConnString   = "dbname=inventory sslmode=disable"
-	DefaultAccount      = "181657471068"
 	DefaultRegion       = "us-east-1"
+	DefaultLogLevel     = "info"
+	DefaultAuthMethods  = "token"
+	DefaultCooldown     = "24h"
 )
 
 var (
@@ -26,45 +37,204 @@ var (
 	port         string
 	account      string
 	region       string
+	logLevel     string
+	tracingOn    bool
+	otlpEndpoint string
+
+	authMethods     string
+	tlsCert         string
+	tlsKey          string
+	clientCA        string
+	certRoles       string
+	certDefaultRole string
+	oidcIssuer      string
+	oidcAudience    string
+	oidcJWKS        string
+	oidcRoleClaim   string
+
+	cooldown  string
+	cooldowns string
+
+	paletteFallback string
+	fallbackWords   string
+	paletteLowWater int
+	colorStrategy   string
+	colorSeed       int64
+
+	idempotencyWindow time.Duration
+
+	ownerPrecedence string
+	ownerTag        string
+	defaultOwner    string
+	tagPolicy       string
+	tagLimits       string
 )
 
 func init() {
 	flag.StringVar(&connString, "connString", DefaultConnString, "The Database ConnectionString")
 	flag.StringVar(&port, "port", DefaultPort, "The default port to listen")
 	flag.IntVar(&pollInterval, "pollInterval", DefaultPollInterval, "Poll Interval in seconds")
-	flag.StringVar(&account, "account", DefaultAccount, "The aws account you're polling")
+	flag.StringVar(&account, "account", "", "The aws account you're polling, required")
 	flag.StringVar(&region, "region", DefaultRegion, "AWS region")
+	flag.StringVar(&logLevel, "logLevel", DefaultLogLevel, "Minimum log level: debug, info, warn or error")
+	flag.BoolVar(&tracingOn, "tracing", false, "Export OpenTelemetry spans over OTLP/HTTP")
+	flag.StringVar(&otlpEndpoint, "otlpEndpoint", tracing.DefaultEndpoint, "host:port of the OTLP/HTTP collector")
+	flag.StringVar(&authMethods, "auth", DefaultAuthMethods, "Comma separated auth methods tried in order: token, mtls, oidc, or none")
+	flag.StringVar(&tlsCert, "tlsCert", "", "PEM certificate to serve https with")
+	flag.StringVar(&tlsKey, "tlsKey", "", "PEM key of -tlsCert")
+	flag.StringVar(&clientCA, "clientCA", "", "PEM bundle used to verify client certificates for mtls auth")
+	flag.StringVar(&certRoles, "certRoles", "", "Client certificate roles as cn=role,cn=role")
+	flag.StringVar(&certDefaultRole, "certDefaultRole", "", "Role for verified client certificates not in -certRoles")
+	flag.StringVar(&oidcIssuer, "oidcIssuer", "", "Expected iss of oidc tokens")
+	flag.StringVar(&oidcAudience, "oidcAudience", "", "Expected aud of oidc tokens")
+	flag.StringVar(&oidcJWKS, "oidcJWKS", "", "URL of the oidc provider's JWKS")
+	flag.StringVar(&cooldown, "cooldown", DefaultCooldown, "How long a released color rests before reuse, e.g. 24h or 30d")
+	flag.StringVar(&cooldowns, "cooldowns", "", "Per environment cooldowns as env=duration,... e.g. prod=30d,dev=0s")
+	flag.StringVar(&paletteFallback, "paletteFallback", string(models.FallbackNone), "When no color is free: none, oldest, suffix or words")
+	flag.StringVar(&fallbackWords, "fallbackWords", "", "File of secondary words, one per line, used by -paletteFallback=words")
+	flag.IntVar(&paletteLowWater, "paletteLowWater", 0, "Warn when an allocation leaves fewer free colors than this, 0 disables")
+	flag.StringVar(&colorStrategy, "colorStrategy", string(models.StrategyRandom), "How free colors are chosen: random, lru, alphabetical, seeded or dissimilar")
+	flag.Int64Var(&colorSeed, "colorSeed", 1, "Seed of -colorStrategy=seeded")
+	flag.DurationVar(&idempotencyWindow, "idempotencyWindow", models.DefaultIdempotencyWindow, "How long responses to requests with an Idempotency-Key are replayed")
+	flag.StringVar(&ownerPrecedence, "ownerPrecedence", "request,role,subnet", "Order host owners are resolved in from request, role, environment, pool and subnet")
+	flag.StringVar(&ownerTag, "ownerTag", models.DefaultOwnerTag, "Subnet tag naming the owner of a host")
+	flag.StringVar(&defaultOwner, "defaultOwner", models.DefaultOwner, "Owner of hosts no source names one for")
+	flag.StringVar(&tagPolicy, "tagPolicy", "", "JSON file of rules adding tags to allocated hosts, e.g. config/tags.json")
+	flag.StringVar(&tagLimits, "tagLimits", string(awstags.Reject), "Names and tags breaking aws or dns limits are: reject or truncate")
+	flag.StringVar(&oidcRoleClaim, "oidcRoleClaim", auth.DefaultRoleClaim, "Claim holding read, allocate or admin")
 }
 
 func main() {
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+
+	cmd, ok := commands()[name]
+	if !ok {
+		if name != "help" {
+			fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+		}
+		usage()
+		os.Exit(2)
+	}
+
+	if err := cmd.run(args); err != nil {
+		fmt.Fprintf(os.Stderr, "inventory %s: %s\n", name, err)
+		os.Exit(1)
+	}
+}
+
+// serve runs the sync jobs and the api, it is what the binary did before it
+// had subcommands so its flags are still accepted without one
+func serve(args []string) error {
+	if _, err := loadConfig(flag.CommandLine, args); err != nil {
+		return err
+	}
+	if errs := validateServe(); len(errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n  %s", strings.Join(errs, "\n  "))
+	}
+
+	level, err := logging.ParseLevel(logLevel)
+	if err != nil {
+		return fmt.Errorf("could not parse -logLevel: %s", err)
+	}
+	logging.Default().SetLevel(level)
 
-	flag.Parse()
+	shutdownTracing, err := tracing.Setup(context.Background(),
+		tracing.WithEnabled(tracingOn),
+		tracing.WithEndpoint(otlpEndpoint),
+	)
+	if err != nil {
+		return fmt.Errorf("could not set up tracing: %s", err)
+	}
+	defer shutdownTracing(context.Background())
 
 	d, err := db.New(db.WithConnString(connString))
+	if err != nil {
+		return fmt.Errorf("could not connect to the database: %s", err)
+	}
+	defer d.Conn.Close()
+
+	defaultCooldown, err := models.ParseCooldown(cooldown)
+	if err != nil {
+		return fmt.Errorf("could not parse -cooldown: %s", err)
+	}
+	scopeCooldowns, err := models.ParseCooldowns(cooldowns)
+	if err != nil {
+		return fmt.Errorf("could not parse -cooldowns: %s", err)
+	}
+	cooldownPolicy := models.NewCooldownPolicy(defaultCooldown, scopeCooldowns)
 
-	checkError(err, "db.New()")
+	fallback, err := models.ParseFallback(paletteFallback)
+	if err != nil {
+		return fmt.Errorf("could not parse -paletteFallback: %s", err)
+	}
+	var words []string
+	if fallbackWords != "" {
+		if words, err = models.ReadWordList(fallbackWords); err != nil {
+			return fmt.Errorf("could not read -fallbackWords: %s", err)
+		}
+	}
+	palettePolicy, err := models.NewPalettePolicy(fallback, words, paletteLowWater)
+	if err != nil {
+		return fmt.Errorf("could not configure palette policy: %s", err)
+	}
+
+	strategy, err := models.ParseStrategy(colorStrategy)
+	if err != nil {
+		return fmt.Errorf("could not parse -colorStrategy: %s", err)
+	}
+
+	precedence, err := models.ParseOwnerPrecedence(ownerPrecedence)
+	if err != nil {
+		return fmt.Errorf("could not parse -ownerPrecedence: %s", err)
+	}
+
+	tags := &models.TagPolicy{}
+	if tagPolicy != "" {
+		if tags, err = models.LoadTagPolicy(tagPolicy); err != nil {
+			return fmt.Errorf("could not load -tagPolicy: %s", err)
+		}
+	}
+
+	limitMode, err := awstags.ParseMode(tagLimits)
+	if err != nil {
+		return fmt.Errorf("could not parse -tagLimits: %s", err)
+	}
+
+	authn, err := buildAuthenticator(d)
+	if err != nil {
+		return fmt.Errorf("could not configure authentication: %s", err)
+	}
 
 	job, err := runners.NewJob(
 		runners.WithAwsConnection(region, account),
 		runners.WithDataBase(d.Conn),
 	)
-
-	checkError(err, "runners.NewJob(AWS Population Job)")
+	if err != nil {
+		return fmt.Errorf("could not create the aws population job: %s", err)
+	}
 
 	runInstances, err := runners.New(
 		runners.WithInterval(pollInterval),
+		runners.WithName("instances"),
 		runners.WithDescription("AWS Population Job Instances"),
 		runners.WithJob(job),
 	)
-	checkError(err, "runners.New()")
+	if err != nil {
+		return fmt.Errorf("could not create the instances runner: %s", err)
+	}
 
 	runSubnets, err := runners.New(
 		runners.WithInterval(pollInterval),
+		runners.WithName("subnets"),
 		runners.WithDescription("AWS Population Job Subnets"),
 		runners.WithJob(job),
 	)
-
-	checkError(err, "runners.New()")
+	if err != nil {
+		return fmt.Errorf("could not create the subnets runner: %s", err)
+	}
 
 	log.Println("Initiating instances routine")
 
@@ -74,20 +244,26 @@ func main() {
 	// before starting the api wait  for things to be retrieved
 	time.Sleep(30 * time.Second)
 
+	if err := metrics.RegisterColorCollector(d.Conn, cooldownPolicy); err != nil {
+		return fmt.Errorf("could not register color metrics: %s", err)
+	}
+
 	//  create api server
-	server := server.New(server.WithDAO(d))
+	server := server.New(
+		server.WithDAO(d),
+		server.WithRunners(runInstances, runSubnets),
+		server.WithAuthenticator(authn),
+		server.WithCooldownPolicy(cooldownPolicy),
+		server.WithPalettePolicy(palettePolicy),
+		server.WithSelector(models.NewSelector(strategy, colorSeed)),
+		server.WithIdempotencyWindow(idempotencyWindow),
+		server.WithOwnerPolicy(models.NewOwnerPolicy(precedence, ownerTag, defaultOwner)),
+		server.WithTagPolicy(tags),
+		server.WithTagLimits(awstags.NewChecker(limitMode)),
+	)
 
 	router := server.LoadHandlers()
 
 	log.Println("Serving new inventory connections")
-	log.Fatal(http.ListenAndServe(port, router))
-
-}
-
-// helper function
-func checkError(err error, function string) {
-	if err != nil {
-		log.Printf("recived error from fn %s: err: %s", function, err)
-	}
-
+	return listen(router)
 }
@@ -0,0 +1,196 @@
+package metrics
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/mleone896/inventory/models"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Namespace prefixes every metric exported by the service
+const Namespace = "inventory"
+
+var (
+	// AllocationDuration observes how long /v1/new_host takes to hand out a name
+	AllocationDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Subsystem: "allocation",
+		Name:      "duration_seconds",
+		Help:      "Time taken to allocate a color and name for a new host.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	// AllocationFailures counts failed allocations by reason
+	AllocationFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: "allocation",
+		Name:      "failures_total",
+		Help:      "Allocations that did not return a name, by reason.",
+	}, []string{"reason"})
+
+	// PaletteLow counts allocations that left fewer free colors than the
+	// palette policy's low water mark
+	PaletteLow = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: "palette",
+		Name:      "low_total",
+		Help:      "Allocations that left the palette below its low water mark, by scope.",
+	}, []string{"scope"})
+
+	// PaletteFallbacks counts colors handed out by the exhaustion fallback
+	PaletteFallbacks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: "palette",
+		Name:      "fallbacks_total",
+		Help:      "Colors handed out by the exhaustion fallback, by scope and fallback.",
+	}, []string{"scope", "fallback"})
+
+	// JobDuration observes how long each runner sync takes
+	JobDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Subsystem: "job",
+		Name:      "duration_seconds",
+		Help:      "Duration of runner syncs.",
+		Buckets:   []float64{.1, .5, 1, 2.5, 5, 10, 30, 60, 120},
+	}, []string{"job"})
+
+	// JobItemsSynced is the number of items the last run of a job synced
+	JobItemsSynced = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Subsystem: "job",
+		Name:      "items_synced",
+		Help:      "Items synced by the most recent run of a job.",
+	}, []string{"job"})
+
+	// JobRuns counts runner executions by outcome
+	JobRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: "job",
+		Name:      "runs_total",
+		Help:      "Runner executions by outcome.",
+	}, []string{"job", "status"})
+
+	// HistorySyncFailures counts instance syncs whose color history could not
+	// be recorded, the color sync itself goes on
+	HistorySyncFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: "job",
+		Name:      "history_sync_failures_total",
+		Help:      "Instance syncs that failed to record color history.",
+	})
+
+	// AWSCalls counts calls made to the AWS API by operation
+	AWSCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: "aws",
+		Name:      "calls_total",
+		Help:      "AWS API calls by operation.",
+	}, []string{"operation"})
+
+	// AWSErrors counts failed calls to the AWS API by operation
+	AWSErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: "aws",
+		Name:      "errors_total",
+		Help:      "AWS API calls that returned an error by operation.",
+	}, []string{"operation"})
+
+	// HTTPRequests counts api requests by route, method and status code
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	// HTTPDuration observes api latency by route and method
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by route and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		AllocationDuration,
+		AllocationFailures,
+		PaletteLow,
+		PaletteFallbacks,
+		JobDuration,
+		JobItemsSynced,
+		JobRuns,
+		HistorySyncFailures,
+		AWSCalls,
+		AWSErrors,
+		HTTPRequests,
+		HTTPDuration,
+	)
+}
+
+// Handler returns the http handler that serves /metrics
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// RegisterColorCollector exports the palette state of db on /metrics
+func RegisterColorCollector(db *sqlx.DB, policy *models.CooldownPolicy) error {
+	return prometheus.Register(NewColorCollector(db, policy))
+}
+
+// ColorCollector reports the palette state from the database on every scrape,
+// once per cooldown scope since what counts as free depends on the cooldown
+type ColorCollector struct {
+	db     *sqlx.DB
+	policy *models.CooldownPolicy
+	desc   *prometheus.Desc
+}
+
+// NewColorCollector returns a collector reading color counts from db
+func NewColorCollector(db *sqlx.DB, policy *models.CooldownPolicy) *ColorCollector {
+	return &ColorCollector{
+		db:     db,
+		policy: policy,
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "colors", "count"),
+			"Colors in the palette by scope and state.",
+			[]string{"scope", "state"},
+			nil,
+		),
+	}
+}
+
+// Describe satisfies prometheus.Collector
+func (c *ColorCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+// Collect satisfies prometheus.Collector
+func (c *ColorCollector) Collect(ch chan<- prometheus.Metric) {
+	scopes := map[string]time.Duration{models.DefaultScope: c.policy.For(models.DefaultScope)}
+	if c.policy != nil {
+		for scope, d := range c.policy.Scopes {
+			scopes[scope] = d
+		}
+	}
+
+	for scope, cooldown := range scopes {
+		color, _ := models.NewColor(models.WithCooldown(cooldown))
+		counts, err := color.Counts(c.db)
+		if err != nil {
+			log.Printf("metrics: could not collect color counts for %s: %s", scope, err)
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(counts.Free), scope, "free")
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(counts.InUse), scope, "in_use")
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(counts.CoolingDown), scope, "cooling_down")
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(counts.Blocked), scope, "blocked")
+	}
+}
@@ -0,0 +1,123 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	dbp "github.com/mleone896/inventory/db"
+)
+
+// MaxAllocationSize bounds the colors handed out by a single allocation
+const MaxAllocationSize = 100
+
+// AllocationItem is one color of an allocation, the account it is allocated
+// in and the owner of the host it names
+type AllocationItem struct {
+	Color     *Color
+	AccountID string
+	Owner     string
+}
+
+// Allocation hands out several colors in one transaction, all or nothing,
+// opening a pending assignment for each
+type Allocation struct {
+	Items  []AllocationItem
+	dryRun bool
+}
+
+// AllocationConfigFun type allows function option configuration
+type AllocationConfigFun func(*Allocation)
+
+// NewAllocation constructor for an empty allocation
+func NewAllocation(opts ...func(*Allocation)) *Allocation {
+	a := &Allocation{Items: []AllocationItem{}}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return a
+}
+
+// WithDryRun makes Get pick colors as it would without locking or writing
+// them
+func WithDryRun(dryRun bool) AllocationConfigFun {
+	return func(a *Allocation) {
+		a.dryRun = dryRun
+	}
+}
+
+// Add queues color, configured as it would be for Get, for accountID
+func (a *Allocation) Add(color *Color, accountID, owner string) {
+	a.Items = append(a.Items, AllocationItem{Color: color, AccountID: accountID, Owner: owner})
+}
+
+// Get statisfies the Getter interface, every color is populated once the
+// transaction commits. The first color that can't be handed out fails and
+// rolls back the whole allocation
+func (a *Allocation) Get(db *sqlx.DB) error {
+	if len(a.Items) > MaxAllocationSize {
+		return fmt.Errorf("cannot allocate more than %d colors at once", MaxAllocationSize)
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return fmt.Errorf("could not get tx handler: %s", err)
+	}
+
+	defer tx.Rollback()
+
+	picked := make([]string, 0, len(a.Items))
+	for _, item := range a.Items {
+		// keep dissimilar selection apart from colors picked earlier in the
+		// allocation, they have no instances to be found by yet
+		item.Color.siblings = picked
+		item.Color.preview = a.dryRun
+
+		name, err := item.Color.take(tx)
+		if err != nil {
+			return err
+		}
+		picked = append(picked, name)
+
+		if a.dryRun {
+			continue
+		}
+
+		_, err = tx.Exec(`INSERT INTO color_assignments (color, instance_id, account_id, owner) VALUES ($1, '', $2, $3)`,
+			name, item.AccountID, item.Owner)
+		if err != nil {
+			return dbp.TxRollbackHandleError(tx, err)
+		}
+	}
+
+	// a dry run wrote nothing, a fallback name it picked is not in the
+	// palette yet
+	if a.dryRun {
+		for i, item := range a.Items {
+			err := tx.QueryRowx("SELECT * from colors where name = $1", picked[i]).StructScan(item.Color)
+			if errors.Is(err, sql.ErrNoRows) {
+				item.Color.Name = picked[i]
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := dbp.TxCommitHandleError(tx); err != nil {
+		return err
+	}
+
+	for i, item := range a.Items {
+		if err := db.QueryRowx("SELECT * from colors where name = $1", picked[i]).StructScan(item.Color); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
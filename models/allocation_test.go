@@ -0,0 +1,72 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestAllocationIsAllOrNothing(t *testing.T) {
+	mod, mock := initTestDB()
+	defer mod.Conn.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT .* FROM colors").
+		WillReturnRows(sqlmock.NewRows(returnColorCols()).AddRow(1, "orange", false, time.Now()))
+	mock.ExpectExec("UPDATE colors SET in_use = true.*").
+		WithArgs("orange").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO color_assignments").
+		WithArgs("orange", "181657471068", "web-team").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery("SELECT .* FROM colors").
+		WillReturnRows(sqlmock.NewRows(returnColorCols()))
+	mock.ExpectQuery("SELECT .*count.* FROM colors").
+		WillReturnRows(sqlmock.NewRows([]string{"cooling_down", "contended"}).AddRow(0, 0))
+	mock.ExpectRollback()
+
+	alloc := NewAllocation()
+	for i := 0; i < 2; i++ {
+		color, err := NewColor()
+		errCheck(err, t)
+		alloc.Add(color, "181657471068", "web-team")
+	}
+
+	if err := alloc.Get(mod.Conn); !errors.Is(err, ErrPaletteExhausted) {
+		t.Fatalf("expected the second color to exhaust the palette got: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there are unfulfilled expectations: %s", err)
+	}
+}
+
+func TestAllocationDryRunWritesNothing(t *testing.T) {
+	mod, mock := initTestDB()
+	defer mod.Conn.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM colors.*NOT \(name = ANY\(\$3\)\)`).
+		WillReturnRows(sqlmock.NewRows(returnColorCols()).AddRow(1, "orange", false, time.Now()))
+	mock.ExpectQuery("SELECT .* from colors where name").
+		WithArgs("orange").
+		WillReturnRows(sqlmock.NewRows(returnColorCols()).AddRow(1, "orange", false, time.Now()))
+	mock.ExpectRollback()
+
+	color, err := NewColor()
+	errCheck(err, t)
+
+	alloc := NewAllocation(WithDryRun(true))
+	alloc.Add(color, "181657471068", "web-team")
+	errCheck(alloc.Get(mod.Conn), t)
+
+	if color.Name != "orange" {
+		t.Errorf("expected a preview of orange got: %s", color.Name)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there are unfulfilled expectations: %s", err)
+	}
+}
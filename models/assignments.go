@@ -0,0 +1,180 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	dbp "github.com/mleone896/inventory/db"
+)
+
+// PendingAssignmentGrace is how long an allocated color may go without an
+// instance carrying it before its assignment is closed
+const PendingAssignmentGrace = time.Hour
+
+// ColorAssignment is one period during which a color was held, by an
+// instance or by an allocation waiting for its instance to launch
+type ColorAssignment struct {
+	ID         int        `json:"id"`
+	Color      string     `json:"color"`
+	InstanceID string     `json:"instance_id"`
+	AccountID  string     `json:"account_id"`
+	Owner      string     `json:"owner"`
+	StartedAt  time.Time  `json:"started_at"`
+	EndedAt    *time.Time `json:"ended_at"`
+}
+
+// ColorAssignmentConfigFun type allows function option configuration
+type ColorAssignmentConfigFun func(*ColorAssignment)
+
+// NewColorAssignment constructor for a new color assignment
+func NewColorAssignment(opts ...func(*ColorAssignment)) *ColorAssignment {
+	ca := &ColorAssignment{}
+
+	for _, opt := range opts {
+		opt(ca)
+	}
+
+	return ca
+}
+
+// WithAssignedColor sets the color of the assignment
+func WithAssignedColor(color string) ColorAssignmentConfigFun {
+	return func(ca *ColorAssignment) {
+		ca.Color = color
+	}
+}
+
+// WithAssignedAccount sets the account the color is held in
+func WithAssignedAccount(id string) ColorAssignmentConfigFun {
+	return func(ca *ColorAssignment) {
+		ca.AccountID = id
+	}
+}
+
+// WithAssignedOwner sets the owner of the host holding the color
+func WithAssignedOwner(owner string) ColorAssignmentConfigFun {
+	return func(ca *ColorAssignment) {
+		ca.Owner = owner
+	}
+}
+
+// WithAssignedInstance sets the instance holding the color
+func WithAssignedInstance(id string) ColorAssignmentConfigFun {
+	return func(ca *ColorAssignment) {
+		ca.InstanceID = id
+	}
+}
+
+// Create opens a new assignment and returns its id
+func (ca *ColorAssignment) Create(db *sqlx.DB) (string, error) {
+	insert := `
+		INSERT INTO color_assignments (color, instance_id, account_id, owner)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, started_at`
+
+	if err := db.QueryRowx(insert, ca.Color, ca.InstanceID, ca.AccountID, ca.Owner).Scan(&ca.ID, &ca.StartedAt); err != nil {
+		return "", fmt.Errorf("could not insert color assignment: %s", err)
+	}
+
+	return fmt.Sprintf("%d", ca.ID), nil
+}
+
+// FindAll returns every assignment of the color, newest first
+func (ca *ColorAssignment) FindAll(db *sqlx.DB) (*sqlx.Rows, error) {
+	sql := `SELECT * from color_assignments where color = $1 ORDER BY started_at DESC, id DESC`
+
+	rows, err := db.Queryx(sql, ca.Color)
+	if err != nil {
+		return nil, fmt.Errorf("could not select from color_assignments: %s", err)
+	}
+	return rows, nil
+}
+
+// UnpackRows takes a sql.Rows and scans into a struct slice
+func (ca *ColorAssignment) UnpackRows(rows *sqlx.Rows) ([]ColorAssignment, error) {
+	cas := []ColorAssignment{}
+
+	if err := sqlx.StructScan(rows, &cas); err != nil {
+		return nil, fmt.Errorf("could not scan rows into slice %s", err)
+	}
+
+	return cas, nil
+}
+
+// Sync reconciles the open assignments of an account with the colors carried
+// by its running instances. Allocations are bound to the first instance seen
+// with their color, assignments whose instance no longer carries the color
+// are closed
+func (ca *ColorAssignment) Sync(db *sqlx.DB, accountID string, instances []*Instance) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return fmt.Errorf("could not get tx handler: %s", err)
+	}
+
+	defer tx.Rollback()
+
+	open := []ColorAssignment{}
+	err = tx.Select(&open, `SELECT * from color_assignments where ended_at IS NULL and account_id = $1 ORDER BY id`, accountID)
+	if err != nil {
+		return dbp.TxRollbackHandleError(tx, err)
+	}
+
+	held := make(map[string]bool, len(open))
+	pending := make(map[string]ColorAssignment)
+	for _, a := range open {
+		if a.InstanceID == "" {
+			if _, ok := pending[a.Color]; !ok {
+				pending[a.Color] = a
+			}
+			continue
+		}
+		held[a.Color+"/"+a.InstanceID] = true
+	}
+
+	current := make(map[string]bool, len(instances))
+	bound := make(map[int]bool)
+	for _, inst := range instances {
+		tag, ok := inst.Tags.Map["color"]
+		if !ok || tag.String == "" {
+			continue
+		}
+		color := tag.String
+		key := color + "/" + inst.InstanceID
+		current[key] = true
+
+		if held[key] {
+			continue
+		}
+
+		if p, ok := pending[color]; ok {
+			_, err = tx.Exec(`UPDATE color_assignments SET instance_id = $1 WHERE id = $2`, inst.InstanceID, p.ID)
+			delete(pending, color)
+			bound[p.ID] = true
+		} else {
+			_, err = tx.Exec(`INSERT INTO color_assignments (color, instance_id, account_id) VALUES ($1, $2, $3)`,
+				color, inst.InstanceID, accountID)
+		}
+		if err != nil {
+			return dbp.TxRollbackHandleError(tx, err)
+		}
+		held[key] = true
+	}
+
+	cutoff := time.Now().Add(-PendingAssignmentGrace)
+	for _, a := range open {
+		stale := a.InstanceID != "" && !current[a.Color+"/"+a.InstanceID]
+		if a.InstanceID == "" && !bound[a.ID] && a.StartedAt.Before(cutoff) {
+			stale = true
+		}
+		if !stale {
+			continue
+		}
+
+		if _, err := tx.Exec(`UPDATE color_assignments SET ended_at = NOW() WHERE id = $1`, a.ID); err != nil {
+			return dbp.TxRollbackHandleError(tx, err)
+		}
+	}
+
+	return dbp.TxCommitHandleError(tx)
+}
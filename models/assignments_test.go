@@ -0,0 +1,69 @@
+package models
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq/hstore"
+)
+
+func returnAssignmentCols() []string {
+	cols := []string{"id", "color", "instance_id", "account_id", "started_at", "ended_at"}
+	return cols
+}
+
+func colorTagged(instanceID, color string) *Instance {
+	return &Instance{
+		InstanceID: instanceID,
+		AccountID:  "238967563593",
+		Tags:       hstore.Hstore{Map: map[string]sql.NullString{"color": {String: color, Valid: true}}},
+	}
+}
+
+func TestColorAssignmentSync(t *testing.T) {
+	mod, mock := initTestDB()
+	defer mod.Conn.Close()
+
+	now := time.Now()
+	old := now.Add(-2 * PendingAssignmentGrace)
+
+	open := sqlmock.NewRows(returnAssignmentCols()).
+		AddRow(1, "orange", "", "238967563593", now, nil).
+		AddRow(2, "green", "i-1", "238967563593", old, nil).
+		AddRow(3, "red", "i-2", "238967563593", old, nil).
+		AddRow(4, "blue", "", "238967563593", old, nil)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT .* from color_assignments where ended_at IS NULL").
+		WithArgs("238967563593").
+		WillReturnRows(open)
+	// the pending orange allocation is bound to the instance that launched
+	mock.ExpectExec("UPDATE color_assignments SET instance_id = .*").
+		WithArgs("i-3", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO color_assignments .*").
+		WithArgs("purple", "i-4", "238967563593").
+		WillReturnResult(sqlmock.NewResult(5, 1))
+	// red's instance went away and blue was never launched
+	mock.ExpectExec("UPDATE color_assignments SET ended_at = .*").
+		WithArgs(3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE color_assignments SET ended_at = .*").
+		WithArgs(4).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	instances := []*Instance{
+		colorTagged("i-1", "green"),
+		colorTagged("i-3", "orange"),
+		colorTagged("i-4", "purple"),
+	}
+
+	errCheck(NewColorAssignment().Sync(mod.Conn, "238967563593", instances), t)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
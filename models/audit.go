@@ -0,0 +1,167 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/types"
+)
+
+// DefaultAuditLimit is the number of events returned when no limit is given
+const DefaultAuditLimit = 100
+
+// audit actions recorded by the api and the runners
+const (
+	AuditAllocate     = "host.allocate"
+	AuditColorClaim   = "color.claim"
+	AuditColorRelease = "color.release"
+	AuditColorAdd     = "color.add"
+	AuditColorRetire  = "color.retire"
+	AuditColorBlock   = "color.block"
+	AuditColorUnblock = "color.unblock"
+	AuditJobTrigger   = "job.trigger"
+	AuditTokenCreate  = "token.create"
+
+	AuditRegistryCreate    = "registry.create"
+	AuditRegistryUpdate    = "registry.update"
+	AuditRegistryDelete    = "registry.delete"
+	AuditCombinationAdd    = "combination.add"
+	AuditCombinationRemove = "combination.remove"
+)
+
+// AuditEvent is a single recorded allocation, mutation or admin action
+type AuditEvent struct {
+	ID         int            `json:"id"`
+	OccurredAt time.Time      `json:"occurred_at"`
+	Actor      string         `json:"actor"`
+	Action     string         `json:"action"`
+	Color      string         `json:"color,omitempty"`
+	RequestID  string         `json:"request_id,omitempty"`
+	Details    types.JSONText `json:"details"`
+}
+
+// AuditFilter narrows the events returned by FindAll
+type AuditFilter struct {
+	Since time.Time
+	Actor string
+	Color string
+	Limit int
+}
+
+// AuditConfigFun type allows function option configuration
+type AuditConfigFun func(*AuditEvent)
+
+// NewAuditEvent constructor for a new audit event
+func NewAuditEvent(action, actor string, opts ...func(*AuditEvent)) *AuditEvent {
+	ev := &AuditEvent{
+		Action:  action,
+		Actor:   actor,
+		Details: types.JSONText("{}"),
+	}
+
+	for _, opt := range opts {
+		opt(ev)
+	}
+
+	return ev
+}
+
+// WithAuditColor sets the color the event concerns
+func WithAuditColor(color string) AuditConfigFun {
+	return func(ev *AuditEvent) {
+		ev.Color = color
+	}
+}
+
+// WithAuditRequestID ties the event to the api request that caused it
+func WithAuditRequestID(id string) AuditConfigFun {
+	return func(ev *AuditEvent) {
+		ev.RequestID = id
+	}
+}
+
+// WithAuditDetails stores v marshalled to json, e.g. a request and response
+func WithAuditDetails(v interface{}) AuditConfigFun {
+	return func(ev *AuditEvent) {
+		if b, err := json.Marshal(v); err == nil {
+			ev.Details = types.JSONText(b)
+		}
+	}
+}
+
+// Create inserts the event and returns the new id
+func (ev *AuditEvent) Create(db *sqlx.DB) (string, error) {
+	insert := `
+		INSERT INTO audit_events (actor, action, color, request_id, details)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, occurred_at`
+
+	err := db.QueryRowx(insert, ev.Actor, ev.Action, ev.Color, ev.RequestID, ev.Details).
+		Scan(&ev.ID, &ev.OccurredAt)
+	if err != nil {
+		return "", fmt.Errorf("could not insert audit event: %s", err)
+	}
+
+	return fmt.Sprintf("%d", ev.ID), nil
+}
+
+// AuditEvents returns a finder for events matching f
+func AuditEvents(f AuditFilter) *AuditFinder {
+	if f.Limit < 1 {
+		f.Limit = DefaultAuditLimit
+	}
+	return &AuditFinder{filter: f}
+}
+
+// AuditFinder satisfies SelectAller for a filtered audit query
+type AuditFinder struct {
+	filter AuditFilter
+}
+
+// FindAll returns the matching events, newest first
+func (a *AuditFinder) FindAll(db *sqlx.DB) (*sqlx.Rows, error) {
+	where := []string{}
+	args := []interface{}{}
+
+	add := func(clause string, arg interface{}) {
+		args = append(args, arg)
+		where = append(where, fmt.Sprintf(clause, len(args)))
+	}
+
+	if !a.filter.Since.IsZero() {
+		add("occurred_at >= $%d", a.filter.Since)
+	}
+	if a.filter.Actor != "" {
+		add("actor = $%d", a.filter.Actor)
+	}
+	if a.filter.Color != "" {
+		add("color = $%d", a.filter.Color)
+	}
+
+	sql := `SELECT * from audit_events`
+	if len(where) > 0 {
+		sql += " where " + strings.Join(where, " and ")
+	}
+	args = append(args, a.filter.Limit)
+	sql += fmt.Sprintf(" ORDER BY occurred_at DESC, id DESC LIMIT $%d", len(args))
+
+	rows, err := db.Queryx(sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not select from audit_events: %s", err)
+	}
+	return rows, nil
+}
+
+// UnpackRows takes a sql.Rows and scans into a struct slice
+func (a *AuditFinder) UnpackRows(rows *sqlx.Rows) ([]AuditEvent, error) {
+	evs := []AuditEvent{}
+
+	if err := sqlx.StructScan(rows, &evs); err != nil {
+		return nil, fmt.Errorf("could not scan rows into slice %s", err)
+	}
+
+	return evs, nil
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx/types"
+)
+
+func returnAuditCols() []string {
+	cols := []string{"id", "occurred_at", "actor", "action", "color", "request_id", "details"}
+	return cols
+}
+
+func TestAuditEventCreate(t *testing.T) {
+	mod, mock := initTestDB()
+	defer mod.Conn.Close()
+
+	ev := NewAuditEvent(AuditAllocate, "token:ci",
+		WithAuditColor("orange"),
+		WithAuditRequestID("abc"),
+		WithAuditDetails(map[string]string{"name": "p-web-a-orange-1a"}),
+	)
+
+	mock.ExpectQuery("INSERT INTO audit_events .*").
+		WithArgs("token:ci", AuditAllocate, "orange", "abc", types.JSONText(`{"name":"p-web-a-orange-1a"}`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "occurred_at"}).AddRow(5, time.Now()))
+
+	id, err := mod.Create(ev)
+	errCheck(err, t)
+
+	if id != "5" {
+		t.Errorf("expected id 5 got: %s", id)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestAuditEventsFilter(t *testing.T) {
+	mod, mock := initTestDB()
+	defer mod.Conn.Close()
+
+	since := time.Now().Add(-time.Hour)
+	rows := sqlmock.NewRows(returnAuditCols()).
+		AddRow(2, time.Now(), "token:ci", AuditAllocate, "orange", "abc", []byte(`{}`))
+
+	mock.ExpectQuery(`SELECT \* from audit_events where occurred_at >= \$1 and color = \$2 ORDER BY .* LIMIT \$3`).
+		WithArgs(since, "orange", DefaultAuditLimit).
+		WillReturnRows(rows)
+
+	obj := AuditEvents(AuditFilter{Since: since, Color: "orange"})
+	res, err := mod.FindAll(obj)
+	errCheck(err, t)
+
+	events, err := obj.UnpackRows(res)
+	errCheck(err, t)
+
+	if len(events) != 1 || events[0].Actor != "token:ci" {
+		t.Errorf("unexpected events got: %+v", events)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -2,12 +2,14 @@ package models
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
-	"math/rand"
 	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/mleone896/inventory/api"
 	dbp "github.com/mleone896/inventory/db"
 )
 
@@ -17,18 +19,74 @@ type Color struct {
 	Name      string    `json:"name"`
 	InUse     bool      `json:"in_use"`
 	LastInUse time.Time `json:"last_in_use"`
+	Blocked   bool      `json:"blocked"`
+	State     string    `json:"state,omitempty"`
+	Holder    string    `json:"holder,omitempty"`
+	cooldown  *time.Duration
+	palette   *PalettePolicy
+	selector  *Selector
+	role      string
+	pool      string
+	replaces  string
+	siblings  []string
+	remaining int
+	fellBack  bool
+	preview   bool
 }
 
+// CandidateLimit is how many free colors are considered per allocation
+const CandidateLimit = 100
+
+// MaxColorNameLen keeps a color usable as a dns label on its own
+const MaxColorNameLen = 63
+
+// ErrColorNotFound is returned when a named color is not in the palette
+var ErrColorNotFound = errors.New("color not found")
+
+// ErrColorUnavailable is returned when a requested color is in use, cooling
+// down or blocked
+var ErrColorUnavailable = errors.New("color is not available")
+
+// ErrColorInUse is returned when a color held by an instance is retired
+var ErrColorInUse = errors.New("color is in use")
+
 // ColoConfigFun type allows function option configuration
 type ColoConfigFun func(*Color)
 
-// SQLGetUnusedColors will never change so save memory by constant
+// SQLGetUnusedColors selects a sample of free colors whose cooldown, in
+// seconds, has passed, ordered by the selector's strategy. Candidates are
+// locked so concurrent allocations draw from different colors
 const SQLGetUnusedColors = `
     SELECT * FROM colors
 	WHERE in_use = false
+	AND blocked = false
+	AND
+	last_in_use <= (NOW() - make_interval(secs => $1))
+	ORDER BY %s
+    LIMIT $2
+	FOR UPDATE SKIP LOCKED
+	`
+
+// SQLPreviewUnusedColors selects the candidates of SQLGetUnusedColors for a
+// dry run, without locking them and leaving out the colors in $3 the dry run
+// already picked
+const SQLPreviewUnusedColors = `
+    SELECT * FROM colors
+	WHERE in_use = false
+	AND blocked = false
 	AND
-	last_in_use < (NOW() - INTERVAL '24 hours')
-    LIMIT 100
+	last_in_use <= (NOW() - make_interval(secs => $1))
+	AND NOT (name = ANY($3))
+	ORDER BY %s
+    LIMIT $2
+	`
+
+// SQLGetPeerColors selects the colors of the instances of a role and pool
+const SQLGetPeerColors = `
+    SELECT DISTINCT tags -> 'color' FROM ec2_instances
+	WHERE tags -> 'role' = $1
+	AND tags -> 'pool' = $2
+	AND tags -> 'color' IS NOT NULL
 	`
 
 // NewColor constructor for a new color
@@ -58,6 +116,56 @@ func WithName(name string) ColoConfigFun {
 	}
 }
 
+// WithCooldown sets how long a color must have been free to be picked
+func WithCooldown(d time.Duration) ColoConfigFun {
+	return func(c *Color) {
+		c.cooldown = &d
+	}
+}
+
+// Cooldown returns how long the color must have been free to be picked
+func (c *Color) Cooldown() time.Duration {
+	if c.cooldown == nil {
+		return DefaultCooldown
+	}
+	return *c.cooldown
+}
+
+// Remaining returns how many free colors were left after Get, it is capped
+// at one less than the candidate limit
+func (c *Color) Remaining() int {
+	return c.remaining
+}
+
+// FellBack reports whether Get handed out a color through the palette
+// policy's fallback
+func (c *Color) FellBack() bool {
+	return c.fellBack
+}
+
+// WithSelector sets the strategy Get chooses between free colors with
+func WithSelector(s *Selector) ColoConfigFun {
+	return func(c *Color) {
+		c.selector = s
+	}
+}
+
+// WithPeers sets the role and pool whose colors a dissimilar selector avoids
+func WithPeers(role, pool string) ColoConfigFun {
+	return func(c *Color) {
+		c.role = role
+		c.pool = pool
+	}
+}
+
+// WithReplacing lets Get claim a color in use or cooling down when the
+// instance being replaced was its last holder
+func WithReplacing(instanceID string) ColoConfigFun {
+	return func(c *Color) {
+		c.replaces = instanceID
+	}
+}
+
 // WithID sets the ID of color called when initializing
 func WithID(id int) ColoConfigFun {
 	return func(c *Color) {
@@ -66,26 +174,18 @@ func WithID(id int) ColoConfigFun {
 }
 
 // Get will retrieve the next color to be used mark it as used update the timestamp
-// and set the appropriate fields in the struct
+// and set the appropriate fields in the struct. A color with a name claims
+// that color instead of choosing one
 func (c *Color) Get(db *sqlx.DB) error {
-	colors := []Color{}
 	tx := db.MustBegin()
 	defer tx.Rollback()
 
-	if err := tx.Select(&colors, SQLGetUnusedColors); err != nil {
+	picked, err := c.take(tx)
+	if err != nil {
 		return err
 	}
-	colorNames := make([]string, len(colors))
-	for i, col := range colors {
-		colorNames[i] = col.Name
-
-	}
-
-	randIndex := rand.Intn(len(colorNames))
-	picked := colorNames[randIndex]
-	tx.MustExec(`UPDATE colors SET in_use = true, last_in_use = NOW() WHERE name = $1`, picked)
 
-	err := tx.Commit()
+	err = tx.Commit()
 	if err != nil {
 		tx.Rollback()
 		return fmt.Errorf("could not commit transaction: %v", err)
@@ -98,6 +198,135 @@ func (c *Color) Get(db *sqlx.DB) error {
 	return nil
 }
 
+// take claims or chooses a color within tx and marks it in use
+func (c *Color) take(tx *sqlx.Tx) (string, error) {
+	var picked string
+	var err error
+	if c.Name != "" {
+		picked, err = c.claim(tx)
+	} else {
+		picked, err = c.choose(tx)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// a dry run writes nothing, the picked color stays free for others
+	if c.preview {
+		return picked, nil
+	}
+
+	if _, err := tx.Exec(`UPDATE colors SET in_use = true, last_in_use = NOW() WHERE name = $1`, picked); err != nil {
+		return "", fmt.Errorf("could not mark color %s in use: %s", picked, err)
+	}
+
+	return picked, nil
+}
+
+// choose picks a free color with the selector, falling back to the palette
+// policy when none is free
+func (c *Color) choose(tx *sqlx.Tx) (string, error) {
+	colors := []Color{}
+
+	if c.preview {
+		query := fmt.Sprintf(SQLPreviewUnusedColors, c.selector.orderBy(true, len(c.siblings)))
+		picked := pq.Array(append([]string{}, c.siblings...))
+		if err := tx.Select(&colors, query, c.Cooldown().Seconds(), CandidateLimit, picked); err != nil {
+			return "", err
+		}
+	} else {
+		query := fmt.Sprintf(SQLGetUnusedColors, c.selector.orderBy(false, 0))
+		if err := tx.Select(&colors, query, c.Cooldown().Seconds(), CandidateLimit); err != nil {
+			return "", err
+		}
+	}
+
+	c.remaining = len(colors) - 1
+	c.fellBack = false
+
+	if len(colors) == 0 {
+		name, err := c.fallback(tx)
+		if err != nil {
+			return "", err
+		}
+		if name == "" {
+			return "", c.exhausted(tx)
+		}
+		c.remaining = 0
+		c.fellBack = true
+		return name, nil
+	}
+
+	peers := []string{}
+	if c.selector.needsPeers() && c.role != "" {
+		if err := tx.Select(&peers, SQLGetPeerColors, c.role, c.pool); err != nil {
+			return "", fmt.Errorf("could not select colors of %s/%s: %s", c.role, c.pool, err)
+		}
+	}
+	return c.selector.pick(colors, append(peers, c.siblings...)), nil
+}
+
+// claim locks the named color and checks it can be handed out: it must be
+// free and cooled down, unless it was last held by the instance being
+// replaced
+func (c *Color) claim(tx *sqlx.Tx) (string, error) {
+	query := `SELECT * FROM colors WHERE name = $1 FOR UPDATE`
+	if c.preview {
+		query = `SELECT * FROM colors WHERE name = $1`
+		if c.previewed(c.Name) {
+			return "", fmt.Errorf("color %s is in use: %w", c.Name, ErrColorUnavailable)
+		}
+	}
+
+	col := Color{}
+	err := tx.QueryRowx(query, c.Name).StructScan(&col)
+	if err == sql.ErrNoRows {
+		return "", ErrColorNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not select color %s: %s", c.Name, err)
+	}
+
+	if col.Blocked {
+		return "", fmt.Errorf("color %s is blocked: %w", c.Name, ErrColorUnavailable)
+	}
+
+	cooling := col.LastInUse.After(time.Now().Add(-c.Cooldown()))
+	if !col.InUse && !cooling {
+		return col.Name, nil
+	}
+
+	if c.replaces != "" {
+		var holder string
+		err := tx.Get(&holder, `
+			SELECT instance_id FROM color_assignments
+			WHERE color = $1
+			ORDER BY started_at DESC, id DESC
+			LIMIT 1`, c.Name)
+		if err != nil && err != sql.ErrNoRows {
+			return "", fmt.Errorf("could not find holder of color %s: %s", c.Name, err)
+		}
+		if holder == c.replaces {
+			return col.Name, nil
+		}
+	}
+
+	if col.InUse {
+		return "", fmt.Errorf("color %s is in use: %w", c.Name, ErrColorUnavailable)
+	}
+	return "", fmt.Errorf("color %s is within its %s cooldown: %w", c.Name, c.Cooldown(), ErrColorUnavailable)
+}
+
+// previewed reports whether a dry run already picked name
+func (c *Color) previewed(name string) bool {
+	for _, s := range c.siblings {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
 // Update marks a color as being used
 func (c *Color) Update(db *sqlx.DB) error {
 	tx := db.MustBegin()
@@ -125,7 +354,7 @@ type ColorSlice []*Color
 // FindAll ...
 func (c *Color) FindAll(db *sqlx.DB) (*sqlx.Rows, error) {
 
-	rows, err := db.Queryx("SELECT * from colors where in_use = 'f'")
+	rows, err := db.Queryx("SELECT * from colors where in_use = 'f' and blocked = 'f'")
 
 	if err != nil {
 		return nil, fmt.Errorf("could not select from color: %s", err)
@@ -134,6 +363,62 @@ func (c *Color) FindAll(db *sqlx.DB) (*sqlx.Rows, error) {
 
 }
 
+// the lifecycle states of a color, ColorStateAll selects every color
+const (
+	ColorStateFree     = "free"
+	ColorStateInUse    = "in_use"
+	ColorStateCooldown = "cooldown"
+	ColorStateBlocked  = "blocked"
+	ColorStateAll      = "all"
+)
+
+// ColorStates lists the states colors can be listed by
+var ColorStates = []string{ColorStateFree, ColorStateInUse, ColorStateCooldown, ColorStateBlocked, ColorStateAll}
+
+// SQLColorStates selects every color with its state under a cooldown, in
+// seconds, and the instance holding it, if any
+const SQLColorStates = `(
+    SELECT colors.*,
+	CASE
+	    WHEN in_use THEN 'in_use'
+	    WHEN blocked THEN 'blocked'
+	    WHEN last_in_use > (NOW() - make_interval(secs => $1)) THEN 'cooldown'
+	    ELSE 'free'
+	END AS state,
+	coalesce(holders.instance_id, '') AS holder
+    FROM colors
+    LEFT JOIN LATERAL (
+	SELECT instance_id FROM ec2_instances
+	WHERE ec2_instances.tags -> 'color' = colors.name
+	ORDER BY id LIMIT 1
+    ) holders ON true
+    ) colors`
+
+// ColorCounts holds the number of colors in each lifecycle state
+type ColorCounts = api.ColorCounts
+
+// SQLCountColorsByState buckets the palette into free, in use and cooling down
+const SQLCountColorsByState = `
+    SELECT
+	count(*) FILTER (WHERE in_use = false AND blocked = false AND last_in_use <= (NOW() - make_interval(secs => $1))) AS free,
+	count(*) FILTER (WHERE in_use = true) AS in_use,
+	count(*) FILTER (WHERE in_use = false AND blocked = false AND last_in_use > (NOW() - make_interval(secs => $1))) AS cooling_down,
+	count(*) FILTER (WHERE in_use = false AND blocked = true) AS blocked
+    FROM colors
+	`
+
+// Counts returns how many colors are free, in use and cooling down under the
+// color's cooldown
+func (c *Color) Counts(db *sqlx.DB) (*ColorCounts, error) {
+	counts := &ColorCounts{}
+
+	if err := db.QueryRowx(SQLCountColorsByState, c.Cooldown().Seconds()).StructScan(counts); err != nil {
+		return nil, fmt.Errorf("could not count colors: %s", err)
+	}
+
+	return counts, nil
+}
+
 // UnpackRows takes a sql.Rows and scans into a struct slice
 func (c Color) UnpackRows(rows *sqlx.Rows) ([]Color, error) {
 	cs := []Color{}
@@ -146,38 +431,85 @@ func (c Color) UnpackRows(rows *sqlx.Rows) ([]Color, error) {
 
 }
 
+// ColorChanges lists the colors a sync claimed for, or released from, use
+type ColorChanges struct {
+	Claimed  []string `json:"claimed"`
+	Released []string `json:"released"`
+}
+
 // Sync marks a color as being used
-func (c Color) Sync(db *sqlx.DB, colors []string) error {
+func (c Color) Sync(db *sqlx.DB, colors []string) (*ColorChanges, error) {
 
 	// now we start a tx, update in_use to false and set in_use to true
 	// with the returned colors from aws... aws is the source of truth
 	tx, err := db.Beginx()
 	if err != nil {
-		return fmt.Errorf("could not get tx handler: %s", err)
+		return nil, fmt.Errorf("could not get tx handler: %s", err)
 	}
 
 	defer tx.Rollback()
 
+	// remember what was in use so the caller can audit what changed
+	previous := []string{}
+	if err := tx.Select(&previous, `SELECT name FROM colors WHERE in_use = true`); err != nil {
+		return nil, dbp.TxRollbackHandleError(tx, err)
+	}
+
 	_, err = tx.Exec(`UPDATE colors SET in_use = false`)
 	if err != nil {
-		return dbp.TxRollbackHandleError(tx, err)
+		return nil, dbp.TxRollbackHandleError(tx, err)
+	}
+
+	wasInUse := make(map[string]bool, len(previous))
+	for _, name := range previous {
+		wasInUse[name] = true
 	}
 
+	changes := &ColorChanges{Claimed: []string{}, Released: []string{}}
+	inUse := make(map[string]bool, len(colors))
+
 	// Loop through all the colors and set the ones in use to true
 	for _, color := range colors {
-		_, err := tx.Exec(`UPDATE colors SET in_use = true, last_in_use = NOW() WHERE name = $1`, color)
+		if color == "" || inUse[color] {
+			continue
+		}
+
+		res, err := tx.Exec(`UPDATE colors SET in_use = true, last_in_use = NOW() WHERE name = $1`, color)
 
 		if err != nil {
-			return dbp.TxRollbackHandleError(tx, err)
+			return nil, dbp.TxRollbackHandleError(tx, err)
+		}
+
+		// colors outside the palette are not tracked
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			continue
 		}
 
+		inUse[color] = true
+		if !wasInUse[color] {
+			changes.Claimed = append(changes.Claimed, color)
+		}
 	}
 
-	return dbp.TxCommitHandleError(tx)
+	for _, name := range previous {
+		if !inUse[name] {
+			changes.Released = append(changes.Released, name)
+		}
+	}
+
+	if err := dbp.TxCommitHandleError(tx); err != nil {
+		return nil, err
+	}
+
+	return changes, nil
 }
 
-// Delete ...
+// Delete retires the named color from the palette, colors held by an
+// instance are refused with ErrColorInUse
 func (c *Color) Delete(db *sqlx.DB) error {
+	if c.Name == "" {
+		return fmt.Errorf("delete: no color specified")
+	}
 
 	tx, err := db.Beginx()
 
@@ -186,11 +518,23 @@ func (c *Color) Delete(db *sqlx.DB) error {
 	}
 	defer func() {
 		if rerr := tx.Rollback(); rerr != nil && rerr != sql.ErrTxDone {
-			log.Printf("failed to rollback subnet tx: %+v", rerr)
+			log.Printf("failed to rollback color tx: %+v", rerr)
 		}
 	}()
 
-	_, err = tx.Exec("DELETE FROM colors")
+	// lock the row so a concurrent allocation can't pick it mid retire
+	if err := tx.QueryRowx("SELECT * FROM colors WHERE name = $1 FOR UPDATE", c.Name).StructScan(c); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrColorNotFound
+		}
+		return dbp.TxRollbackHandleError(tx, err)
+	}
+
+	if c.InUse {
+		return ErrColorInUse
+	}
+
+	_, err = tx.Exec("DELETE FROM colors WHERE name = $1", c.Name)
 	if err != nil {
 		return dbp.TxRollbackHandleError(tx, err)
 	}
@@ -198,3 +542,109 @@ func (c *Color) Delete(db *sqlx.DB) error {
 	return dbp.TxCommitHandleError(tx)
 
 }
+
+// Release frees the named color ahead of the next sync, e.g. after an
+// allocation whose instance was never launched. Its cooldown starts now and
+// its open assignments are closed, colors an instance carries are refused
+// with ErrColorInUse
+func (c *Color) Release(db *sqlx.DB) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return fmt.Errorf("could not get tx handler: %s", err)
+	}
+	defer tx.Rollback()
+
+	var carried int
+	if err := tx.Get(&carried, `SELECT count(*) FROM ec2_instances WHERE tags -> 'color' = $1`, c.Name); err != nil {
+		return dbp.TxRollbackHandleError(tx, err)
+	}
+	if carried > 0 {
+		return ErrColorInUse
+	}
+
+	err = tx.QueryRowx(`UPDATE colors SET in_use = false, last_in_use = NOW() WHERE name = $1 RETURNING *`, c.Name).StructScan(c)
+	if err == sql.ErrNoRows {
+		return ErrColorNotFound
+	}
+	if err != nil {
+		return dbp.TxRollbackHandleError(tx, err)
+	}
+
+	if _, err := tx.Exec(`UPDATE color_assignments SET ended_at = NOW() WHERE color = $1 AND ended_at IS NULL`, c.Name); err != nil {
+		return dbp.TxRollbackHandleError(tx, err)
+	}
+
+	return dbp.TxCommitHandleError(tx)
+}
+
+// SetBlocked blocks or unblocks the named color, blocked colors are never
+// handed out
+func (c *Color) SetBlocked(db *sqlx.DB, blocked bool) error {
+	err := db.QueryRowx(`UPDATE colors SET blocked = $1 WHERE name = $2 RETURNING *`, blocked, c.Name).StructScan(c)
+	if err == sql.ErrNoRows {
+		return ErrColorNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("could not update color %s: %s", c.Name, err)
+	}
+
+	return nil
+}
+
+// AddColors inserts the names into the palette and returns the ones that
+// were not already present
+func AddColors(db *sqlx.DB, names []string) ([]string, error) {
+	for _, name := range names {
+		if err := ValidateColorName(name); err != nil {
+			return nil, err
+		}
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("could not get tx handler: %s", err)
+	}
+
+	defer tx.Rollback()
+
+	added := []string{}
+	for _, name := range names {
+		var inserted string
+		err := tx.QueryRowx(`INSERT INTO colors (name) VALUES ($1) ON CONFLICT (name) DO NOTHING RETURNING name`, name).
+			Scan(&inserted)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, dbp.TxRollbackHandleError(tx, err)
+		}
+		added = append(added, inserted)
+	}
+
+	if err := dbp.TxCommitHandleError(tx); err != nil {
+		return nil, err
+	}
+
+	return added, nil
+}
+
+// ValidateColorName checks a color can be used as a dns label: a lower case
+// letter followed by lower case letters or digits, at most 63 characters.
+// Hyphens are dns safe but would be ambiguous inside a host name, which uses
+// them to separate its parts
+func ValidateColorName(name string) error {
+	if name == "" || len(name) > MaxColorNameLen {
+		return fmt.Errorf("color %q must be between 1 and %d characters", name, MaxColorNameLen)
+	}
+
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return fmt.Errorf("color %q must start with a lower case letter and only contain lower case letters and digits", name)
+		}
+	}
+
+	return nil
+}
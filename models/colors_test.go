@@ -1,6 +1,7 @@
 package models
 
 import (
+	"errors"
 	"fmt"
 	"testing"
 	"time"
@@ -157,3 +158,218 @@ func TestGetAll(t *testing.T) {
 	}
 
 }
+
+func TestColorCounts(t *testing.T) {
+	mod, mock := initTestDB()
+	defer mod.Conn.Close()
+
+	mock.ExpectQuery("SELECT .* FROM colors").
+		WillReturnRows(sqlmock.NewRows([]string{"free", "in_use", "cooling_down"}).AddRow(40, 7, 3))
+
+	counts, err := Colors().Counts(mod.Conn)
+	errCheck(err, t)
+
+	if counts.Free != 40 || counts.InUse != 7 || counts.CoolingDown != 3 {
+		t.Errorf("unexpected color counts got: %+v", counts)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there are unfulfilled expectations: %s", err)
+	}
+}
+
+func TestColorSyncReportsChanges(t *testing.T) {
+	mod, mock := initTestDB()
+	defer mod.Conn.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT name FROM colors WHERE in_use = true").
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("orange").AddRow("green"))
+	mock.ExpectExec("UPDATE colors SET in_use = false").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("UPDATE colors SET in_use = true.*").
+		WithArgs("orange").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE colors SET in_use = true.*").
+		WithArgs("blue").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE colors SET in_use = true.*").
+		WithArgs("notacolor").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	changes, err := Colors().Sync(mod.Conn, []string{"orange", "", "blue", "notacolor", "blue"})
+	errCheck(err, t)
+
+	if len(changes.Claimed) != 1 || changes.Claimed[0] != "blue" {
+		t.Errorf("expected blue to be claimed got: %v", changes.Claimed)
+	}
+
+	if len(changes.Released) != 1 || changes.Released[0] != "green" {
+		t.Errorf("expected green to be released got: %v", changes.Released)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there are unfulfilled expectations: %s", err)
+	}
+}
+
+func TestValidateColorName(t *testing.T) {
+	for _, name := range []string{"orange", "amberwaves", "red2"} {
+		if err := ValidateColorName(name); err != nil {
+			t.Errorf("expected %s to be valid got: %s", name, err)
+		}
+	}
+
+	for _, name := range []string{"", "Orange", "2red", "amber-waves", "blue_green", "ünicorn",
+		"averyveryveryveryveryveryveryveryveryveryveryveryverylongcolorname"} {
+		if err := ValidateColorName(name); err == nil {
+			t.Errorf("expected %q to be invalid", name)
+		}
+	}
+}
+
+func TestAddColorsSkipsExisting(t *testing.T) {
+	mod, mock := initTestDB()
+	defer mod.Conn.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO colors .* ON CONFLICT .*").
+		WithArgs("teal").
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("teal"))
+	mock.ExpectQuery("INSERT INTO colors .* ON CONFLICT .*").
+		WithArgs("orange").
+		WillReturnRows(sqlmock.NewRows([]string{"name"}))
+	mock.ExpectCommit()
+
+	added, err := AddColors(mod.Conn, []string{"teal", "orange"})
+	errCheck(err, t)
+
+	if len(added) != 1 || added[0] != "teal" {
+		t.Errorf("expected only teal to be added got: %v", added)
+	}
+
+	if _, err := AddColors(mod.Conn, []string{"Bad Name"}); err == nil {
+		t.Errorf("expected invalid names to be rejected before touching the db")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there are unfulfilled expectations: %s", err)
+	}
+}
+
+func TestColorDeleteRefusesInUse(t *testing.T) {
+	mod, mock := initTestDB()
+	defer mod.Conn.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT .* FROM colors WHERE name = .* FOR UPDATE").
+		WithArgs("orange").
+		WillReturnRows(returnSingleColor())
+	mock.ExpectRollback()
+
+	c, err := NewColor(WithName("orange"))
+	errCheck(err, t)
+
+	if err := mod.Delete(c); err != ErrColorInUse {
+		t.Errorf("expected ErrColorInUse got: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there are unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetClaimsRequestedColor(t *testing.T) {
+	mod, mock := initTestDB()
+	defer mod.Conn.Close()
+
+	// in use, but last held by the instance being replaced
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT \\* FROM colors WHERE name = .* FOR UPDATE").
+		WithArgs("orange").
+		WillReturnRows(sqlmock.NewRows(returnColorCols()).AddRow(1, "orange", true, time.Now()))
+	mock.ExpectQuery("SELECT instance_id FROM color_assignments").
+		WithArgs("orange").
+		WillReturnRows(sqlmock.NewRows([]string{"instance_id"}).AddRow("i-0abc"))
+	mock.ExpectExec("UPDATE colors SET .*").
+		WithArgs("orange").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery("SELECT .*").
+		WithArgs("orange").
+		WillReturnRows(sqlmock.NewRows(returnColorCols()).AddRow(1, "orange", true, time.Now()))
+
+	color, err := NewColor(WithName("orange"), WithReplacing("i-0abc"))
+	errCheck(err, t)
+	errCheck(color.Get(mod.Conn), t)
+
+	// in use by another instance
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT \\* FROM colors WHERE name = .* FOR UPDATE").
+		WithArgs("orange").
+		WillReturnRows(sqlmock.NewRows(returnColorCols()).AddRow(1, "orange", true, time.Now()))
+	mock.ExpectQuery("SELECT instance_id FROM color_assignments").
+		WithArgs("orange").
+		WillReturnRows(sqlmock.NewRows([]string{"instance_id"}).AddRow("i-0def"))
+	mock.ExpectRollback()
+
+	color, err = NewColor(WithName("orange"), WithReplacing("i-0abc"))
+	errCheck(err, t)
+	if err := color.Get(mod.Conn); !errors.Is(err, ErrColorUnavailable) {
+		t.Errorf("expected color held by another instance to be unavailable got: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there are unfulfilled expectations: %s", err)
+	}
+}
+
+func TestColorRelease(t *testing.T) {
+	mod, mock := initTestDB()
+	defer mod.Conn.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM ec2_instances").
+		WithArgs("orange").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery("UPDATE colors SET in_use = false").
+		WithArgs("orange").
+		WillReturnRows(sqlmock.NewRows(returnColorCols()).AddRow(1, "orange", false, time.Now()))
+	mock.ExpectExec("UPDATE color_assignments SET ended_at").
+		WithArgs("orange").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	c, err := NewColor(WithName("orange"))
+	errCheck(err, t)
+
+	if err := c.Release(mod.Conn); err != nil {
+		t.Errorf("error was not expected while releasing: %s", err)
+	}
+	if c.InUse {
+		t.Errorf("expected orange to be free")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there are unfulfilled expectations: %s", err)
+	}
+}
+
+func TestColorReleaseRefusesCarried(t *testing.T) {
+	mod, mock := initTestDB()
+	defer mod.Conn.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM ec2_instances").
+		WithArgs("orange").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectRollback()
+
+	c, err := NewColor(WithName("orange"))
+	errCheck(err, t)
+
+	if err := c.Release(mod.Conn); err != ErrColorInUse {
+		t.Errorf("expected ErrColorInUse got: %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultCooldown is how long a released color rests before it is reused
+const DefaultCooldown = 24 * time.Hour
+
+// DefaultScope names the cooldown applied to environments without their own
+const DefaultScope = "default"
+
+// CooldownPolicy resolves the cooldown of a scope, scopes are environments
+type CooldownPolicy struct {
+	Default time.Duration
+	Scopes  map[string]time.Duration
+}
+
+// NewCooldownPolicy returns a policy applying def to every scope not in scopes
+func NewCooldownPolicy(def time.Duration, scopes map[string]time.Duration) *CooldownPolicy {
+	if scopes == nil {
+		scopes = make(map[string]time.Duration)
+	}
+	return &CooldownPolicy{Default: def, Scopes: scopes}
+}
+
+// For returns the cooldown of scope
+func (p *CooldownPolicy) For(scope string) time.Duration {
+	if p == nil {
+		return DefaultCooldown
+	}
+	if d, ok := p.Scopes[scope]; ok {
+		return d
+	}
+	return p.Default
+}
+
+// ParseCooldown parses a go duration, additionally accepting whole days as
+// e.g. 30d
+func ParseCooldown(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, fmt.Errorf("invalid cooldown %q: %s", s, err)
+		}
+		s = fmt.Sprintf("%dh", days*24)
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid cooldown %q: %s", s, err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("cooldown %q must not be negative", s)
+	}
+	return d, nil
+}
+
+// ParseCooldowns parses scope=duration pairs separated by commas, e.g.
+// prod=30d,dev=0s
+func ParseCooldowns(s string) (map[string]time.Duration, error) {
+	scopes := make(map[string]time.Duration)
+
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("cooldown %q must be scope=duration", pair)
+		}
+
+		d, err := ParseCooldown(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		scopes[strings.TrimSpace(parts[0])] = d
+	}
+
+	return scopes, nil
+}
@@ -0,0 +1,77 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestCooldownPolicy(t *testing.T) {
+	scopes, err := ParseCooldowns("prod=30d, dev=0s,staging=36h")
+	errCheck(err, t)
+
+	p := NewCooldownPolicy(DefaultCooldown, scopes)
+
+	cases := map[string]time.Duration{
+		"prod":    30 * 24 * time.Hour,
+		"dev":     0,
+		"staging": 36 * time.Hour,
+		"qa":      DefaultCooldown,
+	}
+
+	for scope, want := range cases {
+		if got := p.For(scope); got != want {
+			t.Errorf("%s: expected %s got: %s", scope, want, got)
+		}
+	}
+
+	for _, bad := range []string{"prod", "prod=soon", "=1h", "dev=-1h"} {
+		if _, err := ParseCooldowns(bad); err == nil {
+			t.Errorf("expected %q to fail", bad)
+		}
+	}
+}
+
+func TestGetUsesCooldownAndReportsExhaustion(t *testing.T) {
+	mod, mock := initTestDB()
+	defer mod.Conn.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT .* FROM colors").
+		WithArgs(float64(0), CandidateLimit).
+		WillReturnRows(sqlmock.NewRows(returnColorCols()))
+	mock.ExpectQuery("SELECT .*count.* FROM colors").
+		WithArgs(float64(0)).
+		WillReturnRows(sqlmock.NewRows([]string{"cooling_down", "contended"}).AddRow(3, 0))
+	mock.ExpectRollback()
+
+	color, err := NewColor(WithCooldown(0))
+	errCheck(err, t)
+
+	err = color.Get(mod.Conn)
+	if !errors.Is(err, ErrPaletteExhausted) {
+		t.Fatalf("expected palette exhausted got: %v", err)
+	}
+
+	if e := err.(*ExhaustedError); !e.Temporary() || e.CoolingDown != 3 {
+		t.Errorf("expected 3 colors cooling down got: %+v", e)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there are unfulfilled expectations: %s", err)
+	}
+}
+
+func TestExhaustedReportsContendedColors(t *testing.T) {
+	e := &ExhaustedError{Cooldown: time.Hour, Contended: 2}
+	if !e.Temporary() || !strings.Contains(e.Error(), "2 are held by concurrent allocations") {
+		t.Errorf("expected contended colors to be reported apart from cooling ones got: %s", e)
+	}
+
+	if e := (&ExhaustedError{}); e.Temporary() {
+		t.Errorf("expected a palette with nothing resting or contended to need intervention")
+	}
+}
@@ -0,0 +1,135 @@
+package models
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// DefaultIdempotencyWindow is how long a stored response is replayed
+const DefaultIdempotencyWindow = 24 * time.Hour
+
+// IdempotencyLease is how long an in flight key is held, a request that
+// crashed or panicked without releasing its key is retried after it
+const IdempotencyLease = 2 * time.Minute
+
+// MaxIdempotencyKeyLen bounds the keys accepted from clients
+const MaxIdempotencyKeyLen = 256
+
+// ErrIdempotencyKeyTakenOver is returned when a reservation outlived its lease
+// and another request reserved the key again before it finished
+var ErrIdempotencyKeyTakenOver = errors.New("idempotency key was taken over by another request")
+
+// IdempotencyKey is the stored outcome of a request made with an
+// Idempotency-Key header. A status of 0 means the request is still in flight
+type IdempotencyKey struct {
+	Key         string    `json:"key"`
+	Scope       string    `json:"scope"`
+	RequestHash string    `json:"request_hash"`
+	Status      int       `json:"status"`
+	Response    []byte    `json:"response"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// NewIdempotencyKey returns the key sent for scope, usually the caller and
+// route, with the hash of the payload it was sent with. The scope is stored as
+// its sha256 so long actors and queries always fit
+func NewIdempotencyKey(key, scope string, payload []byte) *IdempotencyKey {
+	scopeSum := sha256.Sum256([]byte(scope))
+	sum := sha256.Sum256(payload)
+	return &IdempotencyKey{
+		Key:         key,
+		Scope:       hex.EncodeToString(scopeSum[:]),
+		RequestHash: hex.EncodeToString(sum[:]),
+	}
+}
+
+// Matches reports whether the stored key was made with the same payload as k
+func (k *IdempotencyKey) Matches(payload []byte) bool {
+	sum := sha256.Sum256(payload)
+	return k.RequestHash == hex.EncodeToString(sum[:])
+}
+
+// InFlight reports whether the first request with the key has not finished
+func (k *IdempotencyKey) InFlight() bool {
+	return k.Status == 0
+}
+
+// Reserve claims the key for a new request, taking over a key older than
+// window or one still in flight past the IdempotencyLease. When the key is already held it reports false and k is populated
+// with the stored request instead
+func (k *IdempotencyKey) Reserve(db *sqlx.DB, window time.Duration) (bool, error) {
+	insert := `
+		INSERT INTO idempotency_keys (key, scope, request_hash)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (scope, key) DO UPDATE
+		SET request_hash = EXCLUDED.request_hash, status = 0, response = NULL, created_at = NOW()
+		WHERE idempotency_keys.created_at < NOW() - make_interval(secs => $4)
+		OR (idempotency_keys.status = 0 AND idempotency_keys.created_at < NOW() - make_interval(secs => $5))
+		RETURNING created_at`
+
+	err := db.QueryRowx(insert, k.Key, k.Scope, k.RequestHash, window.Seconds(), IdempotencyLease.Seconds()).Scan(&k.CreatedAt)
+	if err == nil {
+		return true, nil
+	}
+	if err != sql.ErrNoRows {
+		return false, fmt.Errorf("could not reserve idempotency key: %s", err)
+	}
+
+	err = db.QueryRowx(`SELECT * FROM idempotency_keys WHERE scope = $1 AND key = $2`, k.Scope, k.Key).StructScan(k)
+	if err != nil {
+		return false, fmt.Errorf("could not find idempotency key: %s", err)
+	}
+	return false, nil
+}
+
+// Complete stores the response to replay for the key, as long as the
+// reservation made by Reserve is still the one stored
+func (k *IdempotencyKey) Complete(db *sqlx.DB, status int, response []byte) error {
+	res, err := db.Exec(`
+		UPDATE idempotency_keys SET status = $1, response = $2
+		WHERE scope = $3 AND key = $4 AND created_at = $5 AND request_hash = $6`,
+		status, response, k.Scope, k.Key, k.CreatedAt, k.RequestHash)
+	if err != nil {
+		return fmt.Errorf("could not store idempotent response: %s", err)
+	}
+	if err := ownedReservation(res); err != nil {
+		return err
+	}
+
+	k.Status = status
+	k.Response = response
+	return nil
+}
+
+// Release forgets the key so the request can be retried, used when the first
+// attempt failed without a response worth replaying. A reservation taken over
+// by another request is left alone
+func (k *IdempotencyKey) Release(db *sqlx.DB) error {
+	res, err := db.Exec(`
+		DELETE FROM idempotency_keys
+		WHERE scope = $1 AND key = $2 AND created_at = $3 AND request_hash = $4`,
+		k.Scope, k.Key, k.CreatedAt, k.RequestHash)
+	if err != nil {
+		return fmt.Errorf("could not release idempotency key: %s", err)
+	}
+	return ownedReservation(res)
+}
+
+// ownedReservation reports ErrIdempotencyKeyTakenOver when a guarded write
+// matched no row
+func ownedReservation(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not count idempotency keys written: %s", err)
+	}
+	if n == 0 {
+		return ErrIdempotencyKeyTakenOver
+	}
+	return nil
+}
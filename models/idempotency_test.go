@@ -0,0 +1,70 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestIdempotencyScopeFitsColumn(t *testing.T) {
+	long := "token:ci POST /v1/new_host?" + strings.Repeat("dry_run=true&", 100)
+
+	a := NewIdempotencyKey("k1", long, nil)
+	if len(a.Scope) != 64 {
+		t.Errorf("expected the stored scope to be a sha256 hex got: %d characters", len(a.Scope))
+	}
+
+	if b := NewIdempotencyKey("k1", long+"x", nil); a.Scope == b.Scope {
+		t.Errorf("expected distinct scopes to stay distinct")
+	}
+}
+
+func TestIdempotencyTakenOverReservationIsLeftAlone(t *testing.T) {
+	mod, mock := initTestDB()
+	defer mod.Conn.Close()
+
+	first := NewIdempotencyKey("k1", "token:ci POST /v1/new_host", []byte(`{}`))
+	second := NewIdempotencyKey("k1", "token:ci POST /v1/new_host", []byte(`{}`))
+	reservedAt := time.Now().Add(-3 * IdempotencyLease)
+	takenAt := time.Now()
+
+	mock.ExpectQuery("INSERT INTO idempotency_keys").
+		WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(reservedAt))
+	// the first request outlives its lease and the retry takes the key over
+	mock.ExpectQuery("INSERT INTO idempotency_keys").
+		WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(takenAt))
+	mock.ExpectExec("UPDATE idempotency_keys SET status").
+		WithArgs(200, []byte(`{"color":"orange"}`), first.Scope, "k1", reservedAt, first.RequestHash).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM idempotency_keys").
+		WithArgs(first.Scope, "k1", reservedAt, first.RequestHash).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("UPDATE idempotency_keys SET status").
+		WithArgs(201, []byte(`{"color":"teal"}`), second.Scope, "k1", takenAt, second.RequestHash).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	for _, k := range []*IdempotencyKey{first, second} {
+		reserved, err := k.Reserve(mod.Conn, DefaultIdempotencyWindow)
+		errCheck(err, t)
+		if !reserved {
+			t.Fatalf("expected the key to be reserved")
+		}
+	}
+
+	if err := first.Complete(mod.Conn, 200, []byte(`{"color":"orange"}`)); !errors.Is(err, ErrIdempotencyKeyTakenOver) {
+		t.Errorf("expected the stale reservation not to store its response got: %v", err)
+	}
+
+	if err := first.Release(mod.Conn); !errors.Is(err, ErrIdempotencyKeyTakenOver) {
+		t.Errorf("expected the stale reservation not to release the new one got: %v", err)
+	}
+
+	errCheck(second.Complete(mod.Conn, 201, []byte(`{"color":"teal"}`)), t)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there are unfulfilled expectations: %s", err)
+	}
+}
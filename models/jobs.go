@@ -0,0 +1,154 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// DefaultJobRunLimit is the number of runs returned when no limit is given
+const DefaultJobRunLimit = 50
+
+// JobRunRetention is the number of runs kept per job, older runs are pruned
+const JobRunRetention = 1000
+
+// ErrNoJobRuns is returned when a job has never recorded a run
+var ErrNoJobRuns = errors.New("job has no recorded runs")
+
+// JobRun records a single execution of a runner
+type JobRun struct {
+	ID          int       `json:"id"`
+	JobName     string    `json:"job_name"`
+	StartedAt   time.Time `json:"started_at"`
+	FinishedAt  time.Time `json:"finished_at"`
+	DurationMS  int64     `json:"duration_ms"`
+	ItemsSynced int       `json:"items_synced"`
+	Error       string    `json:"error,omitempty"`
+	limit       int
+}
+
+// JobRunConfigFun type allows function option configuration
+type JobRunConfigFun func(*JobRun)
+
+// NewJobRun constructor for a new job run
+func NewJobRun(opts ...func(*JobRun)) *JobRun {
+	jr := &JobRun{limit: DefaultJobRunLimit}
+
+	for _, opt := range opts {
+		opt(jr)
+	}
+
+	return jr
+}
+
+// WithJobName sets the name of the job the run belongs to
+func WithJobName(name string) JobRunConfigFun {
+	return func(jr *JobRun) {
+		jr.JobName = name
+	}
+}
+
+// WithRunLimit caps the number of runs FindAll returns
+func WithRunLimit(limit int) JobRunConfigFun {
+	return func(jr *JobRun) {
+		if limit > 0 {
+			jr.limit = limit
+		}
+	}
+}
+
+// Finish stamps the end time, duration, count and error of the run
+func (jr *JobRun) Finish(items int, err error) {
+	jr.FinishedAt = time.Now()
+	jr.DurationMS = int64(jr.FinishedAt.Sub(jr.StartedAt) / time.Millisecond)
+	jr.ItemsSynced = items
+
+	if err != nil {
+		jr.Error = err.Error()
+	}
+}
+
+// Create inserts the run into job_runs and returns the new id
+func (jr *JobRun) Create(db *sqlx.DB) (string, error) {
+	insert := `
+		INSERT INTO job_runs (
+			job_name,
+			started_at,
+			finished_at,
+			duration_ms,
+			items_synced,
+			error
+		)
+		VALUES (
+			:job_name,
+			:started_at,
+			:finished_at,
+			:duration_ms,
+			:items_synced,
+			:error)
+		RETURNING id`
+
+	stmt, err := db.PrepareNamed(insert)
+	if err != nil {
+		return "", fmt.Errorf("could not prepare job run stmt: %s", err)
+	}
+	defer stmt.Close()
+
+	if err := stmt.QueryRowx(jr).Scan(&jr.ID); err != nil {
+		return "", fmt.Errorf("could not insert job run: %s", err)
+	}
+
+	return fmt.Sprintf("%d", jr.ID), nil
+}
+
+// FindAll returns the most recent runs for the job, newest first
+func (jr *JobRun) FindAll(db *sqlx.DB) (*sqlx.Rows, error) {
+	sql := `SELECT * from job_runs where job_name = $1 ORDER BY started_at DESC LIMIT $2`
+
+	rows, err := db.Queryx(sql, jr.JobName, jr.limit)
+	if err != nil {
+		return nil, fmt.Errorf("could not select from job_runs: %s", err)
+	}
+	return rows, nil
+}
+
+// Get populates the struct with the latest run of the job
+func (jr *JobRun) Get(db *sqlx.DB) error {
+	query := `SELECT * from job_runs where job_name = $1 ORDER BY started_at DESC LIMIT 1`
+
+	err := db.QueryRowx(query, jr.JobName).StructScan(jr)
+	if err == sql.ErrNoRows {
+		return ErrNoJobRuns
+	}
+	if err != nil {
+		return fmt.Errorf("could not find runs for job %s: %s", jr.JobName, err)
+	}
+
+	return nil
+}
+
+// Prune deletes the runs of the job older than its newest keep runs
+func (jr *JobRun) Prune(db *sqlx.DB, keep int) (int64, error) {
+	res, err := db.Exec(`
+		DELETE FROM job_runs WHERE job_name = $1 AND id NOT IN (
+			SELECT id FROM job_runs WHERE job_name = $1 ORDER BY started_at DESC LIMIT $2
+		)`, jr.JobName, keep)
+	if err != nil {
+		return 0, fmt.Errorf("could not prune runs of job %s: %s", jr.JobName, err)
+	}
+	return res.RowsAffected()
+}
+
+// UnpackRows takes a sql.Rows and scans into a struct slice
+func (jr JobRun) UnpackRows(rows *sqlx.Rows) ([]JobRun, error) {
+	runs := []JobRun{}
+
+	if err := sqlx.StructScan(rows, &runs); err != nil {
+		return nil, fmt.Errorf("could not scan rows into slice %s", err)
+	}
+
+	return runs, nil
+}
@@ -0,0 +1,136 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func returnJobRunCols() []string {
+	cols := []string{"id", "job_name", "started_at", "finished_at", "duration_ms", "items_synced", "error"}
+	return cols
+}
+
+func TestJobRunFinish(t *testing.T) {
+	jr := NewJobRun(WithJobName("instances"))
+	jr.StartedAt = time.Now().Add(-2 * time.Second)
+
+	jr.Finish(7, fmt.Errorf("aws went away"))
+
+	if jr.ItemsSynced != 7 {
+		t.Errorf("expected 7 items synced got: %d", jr.ItemsSynced)
+	}
+
+	if jr.DurationMS < 2000 {
+		t.Errorf("expected duration of at least 2000ms got: %d", jr.DurationMS)
+	}
+
+	if jr.Error != "aws went away" {
+		t.Errorf("expected error to be recorded got: %q", jr.Error)
+	}
+}
+
+func TestJobRunCreate(t *testing.T) {
+	mod, mock := initTestDB()
+	defer mod.Conn.Close()
+
+	jr := NewJobRun(WithJobName("subnets"))
+	jr.StartedAt = time.Now()
+	jr.Finish(3, nil)
+
+	mock.ExpectPrepare("INSERT INTO job_runs .*").
+		ExpectQuery().
+		WithArgs(jr.JobName, jr.StartedAt, jr.FinishedAt, jr.DurationMS, jr.ItemsSynced, "").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(12))
+
+	id, err := mod.Create(jr)
+	errCheck(err, t)
+
+	if id != "12" {
+		t.Errorf("expected id 12 got: %s", id)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestJobRunFindAll(t *testing.T) {
+	mod, mock := initTestDB()
+	defer mod.Conn.Close()
+
+	now := time.Now()
+	rows := sqlmock.NewRows(returnJobRunCols()).
+		AddRow(2, "instances", now, now, 120, 40, "").
+		AddRow(1, "instances", now, now, 90, 0, "could not describe instances")
+
+	mock.ExpectQuery("SELECT .* from job_runs where job_name = .*").
+		WithArgs("instances", 2).
+		WillReturnRows(rows)
+
+	obj := NewJobRun(WithJobName("instances"), WithRunLimit(2))
+	res, err := mod.FindAll(obj)
+	errCheck(err, t)
+
+	runs, err := obj.UnpackRows(res)
+	errCheck(err, t)
+
+	if len(runs) != 2 {
+		t.Fatalf("expected 2 runs got: %d", len(runs))
+	}
+
+	if runs[1].Error == "" {
+		t.Errorf("expected failed run to carry its error")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestJobRunGetWithoutRuns(t *testing.T) {
+	mod, mock := initTestDB()
+	defer mod.Conn.Close()
+
+	mock.ExpectQuery("SELECT .* from job_runs where job_name = .*").
+		WithArgs("instances").
+		WillReturnRows(sqlmock.NewRows(returnJobRunCols()))
+	mock.ExpectQuery("SELECT .* from job_runs where job_name = .*").
+		WithArgs("instances").
+		WillReturnError(fmt.Errorf("connection refused"))
+
+	if err := mod.Read(NewJobRun(WithJobName("instances"))); !errors.Is(err, ErrNoJobRuns) {
+		t.Errorf("expected ErrNoJobRuns got: %v", err)
+	}
+
+	if err := mod.Read(NewJobRun(WithJobName("instances"))); err == nil || errors.Is(err, ErrNoJobRuns) {
+		t.Errorf("expected a failed read not to look like a job without runs got: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestJobRunPrune(t *testing.T) {
+	mod, mock := initTestDB()
+	defer mod.Conn.Close()
+
+	mock.ExpectExec("DELETE FROM job_runs WHERE job_name = \\$1 AND id NOT IN").
+		WithArgs("instances", JobRunRetention).
+		WillReturnResult(sqlmock.NewResult(0, 4))
+
+	n, err := NewJobRun(WithJobName("instances")).Prune(mod.Conn, JobRunRetention)
+	errCheck(err, t)
+
+	if n != 4 {
+		t.Errorf("expected 4 pruned runs got: %d", n)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,114 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// OwnerSource names a place the owner of a host can be read from
+type OwnerSource string
+
+// the places an owner is resolved from
+const (
+	OwnerFromRequest     OwnerSource = "request"
+	OwnerFromRole        OwnerSource = "role"
+	OwnerFromEnvironment OwnerSource = "environment"
+	OwnerFromPool        OwnerSource = "pool"
+	OwnerFromSubnet      OwnerSource = "subnet"
+	OwnerFromDefault     OwnerSource = "default"
+)
+
+// DefaultOwnerPrecedence is the order sources are tried in when none is
+// configured
+var DefaultOwnerPrecedence = []OwnerSource{OwnerFromRequest, OwnerFromRole, OwnerFromSubnet}
+
+// DefaultOwnerTag is the subnet tag holding an owner
+const DefaultOwnerTag = "team"
+
+// DefaultOwner is used when no source names an owner
+const DefaultOwner = "unassigned"
+
+// OwnerPolicy decides which source the owner of a host comes from
+type OwnerPolicy struct {
+	Precedence []OwnerSource
+	Tag        string
+	Default    string
+}
+
+// NewOwnerPolicy returns a policy trying precedence in order, reading tag
+// from subnets and falling back to def
+func NewOwnerPolicy(precedence []OwnerSource, tag, def string) *OwnerPolicy {
+	if len(precedence) == 0 {
+		precedence = DefaultOwnerPrecedence
+	}
+	if tag == "" {
+		tag = DefaultOwnerTag
+	}
+	return &OwnerPolicy{Precedence: precedence, Tag: tag, Default: def}
+}
+
+// ParseOwnerPrecedence parses a comma separated list of sources, e.g.
+// request,role,subnet
+func ParseOwnerPrecedence(s string) ([]OwnerSource, error) {
+	sources := []OwnerSource{}
+
+	for _, part := range strings.Split(s, ",") {
+		src := OwnerSource(strings.TrimSpace(part))
+		switch src {
+		case "":
+			continue
+		case OwnerFromRequest, OwnerFromRole, OwnerFromEnvironment, OwnerFromPool, OwnerFromSubnet:
+			sources = append(sources, src)
+		default:
+			return nil, fmt.Errorf("unknown owner source %q", src)
+		}
+	}
+
+	return sources, nil
+}
+
+// OwnerInputs holds what an owner can be resolved from for one host
+type OwnerInputs struct {
+	Requested   string
+	Registry    *Registry
+	Environment string
+	Role        string
+	Pool        string
+	Subnet      *Subnet
+}
+
+// Resolve returns the owner from the first source that names one, and the
+// source it came from
+func (p *OwnerPolicy) Resolve(in OwnerInputs) (string, OwnerSource, error) {
+	for _, src := range p.Precedence {
+		var owner string
+
+		switch src {
+		case OwnerFromRequest:
+			owner = in.Requested
+		case OwnerFromRole:
+			owner = in.registryOwner(Roles, in.Role)
+		case OwnerFromEnvironment:
+			owner = in.registryOwner(Environments, in.Environment)
+		case OwnerFromPool:
+			owner = in.registryOwner(Pools, in.Pool)
+		case OwnerFromSubnet:
+			if in.Subnet != nil {
+				owner = in.Subnet.Tags.Map[p.Tag].String
+			}
+		}
+
+		if owner != "" {
+			return owner, src, nil
+		}
+	}
+
+	return p.Default, OwnerFromDefault, nil
+}
+
+func (in OwnerInputs) registryOwner(kind RegistryKind, name string) string {
+	if in.Registry == nil {
+		return ""
+	}
+	return in.Registry.Entries[kind][name].Owner
+}
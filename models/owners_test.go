@@ -0,0 +1,63 @@
+package models
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/lib/pq/hstore"
+)
+
+func TestResolveOwnerPrecedence(t *testing.T) {
+	reg := &Registry{Entries: map[RegistryKind]map[string]RegistryEntry{
+		Roles: {"web": {Name: "web", ShortCode: "w", Owner: "web-team"}},
+	}}
+	subnet := &Subnet{Tags: hstore.Hstore{Map: map[string]sql.NullString{
+		"team": {String: "net-team", Valid: true},
+	}}}
+
+	cases := []struct {
+		precedence []OwnerSource
+		requested  string
+		role       string
+		owner      string
+		source     OwnerSource
+	}{
+		{nil, "me", "web", "me", OwnerFromRequest},
+		{nil, "", "web", "web-team", OwnerFromRole},
+		{nil, "", "db", "net-team", OwnerFromSubnet},
+		{[]OwnerSource{OwnerFromSubnet, OwnerFromRole}, "", "web", "net-team", OwnerFromSubnet},
+		{[]OwnerSource{OwnerFromPool}, "", "web", DefaultOwner, OwnerFromDefault},
+	}
+
+	for _, c := range cases {
+		p := NewOwnerPolicy(c.precedence, "", DefaultOwner)
+		owner, source, err := p.Resolve(OwnerInputs{
+			Requested: c.requested,
+			Registry:  reg,
+			Role:      c.role,
+			Subnet:    subnet,
+		})
+		if err != nil {
+			t.Fatalf("error was not expected while resolving owner: %s", err)
+		}
+		if owner != c.owner || source != c.source {
+			t.Errorf("expected %s from %s got %s from %s", c.owner, c.source, owner, source)
+		}
+	}
+}
+
+func TestParseOwnerPrecedence(t *testing.T) {
+	got, err := ParseOwnerPrecedence("request, pool,subnet")
+	if err != nil {
+		t.Fatalf("error was not expected while parsing precedence: %s", err)
+	}
+	if len(got) != 3 || got[1] != OwnerFromPool {
+		t.Errorf("expected request,pool,subnet got %v", got)
+	}
+
+	for _, s := range []string{"request,team", "request,account"} {
+		if _, err := ParseOwnerPrecedence(s); err == nil {
+			t.Errorf("expected an unknown source in %s to fail", s)
+		}
+	}
+}
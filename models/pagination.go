@@ -0,0 +1,431 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// the bounds of a page of a list
+const (
+	DefaultPageLimit = 100
+	MaxPageLimit     = 1000
+)
+
+// TagFilterPrefix starts filters on a tag, e.g. tag.team=web
+const TagFilterPrefix = "tag."
+
+// ErrInvalidPage is returned for a limit, cursor, sort or filter a list
+// doesn't accept
+var ErrInvalidPage = errors.New("invalid page query")
+
+// PageQuery selects a page of a list: up to Limit rows after Cursor, ordered
+// by Sort, a key prefixed with - for descending, and equal to every filter
+type PageQuery struct {
+	Limit   int
+	Cursor  string
+	Sort    string
+	Filters map[string]string
+}
+
+// listing describes the keys a table can be sorted and filtered by, each
+// mapped to its sql expression
+type listing struct {
+	table       string
+	where       []string
+	sorts       map[string]sortKey
+	filters     map[string]string
+	tags        bool
+	defaultSort string
+}
+
+// sortKey is a sql expression rows are ordered by and its type, cursors hold
+// the key as text and are cast back to it
+type sortKey struct {
+	expr string
+	typ  string
+}
+
+// text sort keys
+func textKey(expr string) sortKey {
+	return sortKey{expr: expr, typ: "text"}
+}
+
+// cursor is the position after the last row of a page, rows are ordered by
+// the sort key then the id so the position is unique
+type cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    int    `json:"id"`
+}
+
+func encodeCursor(c cursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	c := cursor{}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err == nil {
+		err = json.Unmarshal(b, &c)
+	}
+	if err != nil {
+		return c, fmt.Errorf("%w: malformed cursor", ErrInvalidPage)
+	}
+	return c, nil
+}
+
+// sortKeys lists the keys a listing can be sorted by, for error messages
+func (l listing) sortKeys() string {
+	keys := make([]string, 0, len(l.sorts))
+	for key := range l.sorts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ", ")
+}
+
+// check normalizes q, filling in the default limit and sort, and refuses
+// what the listing doesn't accept
+func (l listing) check(q PageQuery) (PageQuery, error) {
+	if q.Limit == 0 {
+		q.Limit = DefaultPageLimit
+	}
+	if q.Limit < 1 || q.Limit > MaxPageLimit {
+		return q, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidPage, MaxPageLimit)
+	}
+
+	if q.Sort == "" {
+		q.Sort = l.defaultSort
+	}
+	if _, ok := l.sorts[strings.TrimPrefix(q.Sort, "-")]; !ok {
+		return q, fmt.Errorf("%w: cannot sort by %q, expected one of %s", ErrInvalidPage, q.Sort, l.sortKeys())
+	}
+
+	for key := range q.Filters {
+		if l.tags && strings.HasPrefix(key, TagFilterPrefix) && len(key) > len(TagFilterPrefix) {
+			continue
+		}
+		if _, ok := l.filters[key]; !ok {
+			return q, fmt.Errorf("%w: cannot filter by %q", ErrInvalidPage, key)
+		}
+	}
+
+	if q.Cursor != "" {
+		c, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return q, err
+		}
+		if c.Sort != q.Sort {
+			return q, fmt.Errorf("%w: cursor is of a list sorted by %q", ErrInvalidPage, c.Sort)
+		}
+	}
+
+	return q, nil
+}
+
+// query builds the select of a page of q, already checked. One row more than
+// the limit is selected to tell whether there is a next page, the sort key of
+// each row is selected as text into sort_key for its cursor. args are those
+// the listing's table refers to
+func (l listing) query(q PageQuery, args ...interface{}) (string, []interface{}) {
+	where := append([]string{}, l.where...)
+
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	keys := make([]string, 0, len(q.Filters))
+	for key := range q.Filters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if expr, ok := l.filters[key]; ok {
+			where = append(where, fmt.Sprintf("%s = %s", expr, arg(q.Filters[key])))
+			continue
+		}
+		tag := strings.TrimPrefix(key, TagFilterPrefix)
+		where = append(where, fmt.Sprintf("tags -> %s = %s", arg(tag), arg(q.Filters[key])))
+	}
+
+	key := l.sorts[strings.TrimPrefix(q.Sort, "-")]
+	order, op := "ASC", ">"
+	if strings.HasPrefix(q.Sort, "-") {
+		order, op = "DESC", "<"
+	}
+
+	if q.Cursor != "" {
+		c, _ := decodeCursor(q.Cursor)
+		where = append(where, fmt.Sprintf("(%s, id) %s (%s::%s, %s)",
+			key.expr, op, arg(c.Value), key.typ, arg(c.ID)))
+	}
+
+	sql := fmt.Sprintf("SELECT *, (%s)::text AS sort_key FROM %s", key.expr, l.table)
+	if len(where) > 0 {
+		sql += " WHERE " + strings.Join(where, " AND ")
+	}
+	sql += fmt.Sprintf(" ORDER BY %s %s, id %s LIMIT %s", key.expr, order, order, arg(q.Limit+1))
+
+	return sql, args
+}
+
+// next returns how many of n rows belong to the page and the cursor of the
+// page after, empty on the last page. key returns the sort key and id of a row
+func (q PageQuery) next(n int, key func(i int) (string, int)) (int, string) {
+	if n <= q.Limit {
+		return n, ""
+	}
+
+	value, id := key(q.Limit - 1)
+	return q.Limit, encodeCursor(cursor{Sort: q.Sort, Value: value, ID: id})
+}
+
+// colorListing is the colors with their state under the cooldown in $1 and
+// holder, see SQLColorStates
+var colorListing = listing{
+	table: SQLColorStates,
+	sorts: map[string]sortKey{
+		"id":          {expr: "id", typ: "integer"},
+		"name":        textKey("name"),
+		"last_in_use": {expr: "last_in_use", typ: "timestamp"},
+		"state":       textKey("state"),
+		"holder":      textKey("holder"),
+	},
+	filters:     map[string]string{"name": "name", "state": "state", "holder": "holder"},
+	defaultSort: "name",
+}
+
+// instanceListing is the synced ec2 instances, their tags filter as tag.<key>
+var instanceListing = listing{
+	table: "ec2_instances",
+	sorts: map[string]sortKey{
+		"id":          {expr: "id", typ: "integer"},
+		"instance_id": textKey("instance_id"),
+		"subnet_id":   textKey("subnet_id"),
+		"account_id":  textKey("account_id"),
+		"color":       textKey("coalesce(tags -> 'color', '')"),
+		"name":        textKey("coalesce(tags -> 'Name', '')"),
+	},
+	filters: map[string]string{
+		"instance_id": "instance_id",
+		"account_id":  "account_id",
+		"subnet_id":   "subnet_id",
+		"color":       "tags -> 'color'",
+		"environment": "tags -> 'environment'",
+		"role":        "tags -> 'role'",
+		"pool":        "tags -> 'pool'",
+		"owner":       "tags -> 'owner'",
+	},
+	tags:        true,
+	defaultSort: "id",
+}
+
+// subnetListing is the synced subnets, their tags filter as tag.<key>
+var subnetListing = listing{
+	table: "subnets",
+	sorts: map[string]sortKey{
+		"id":                {expr: "id", typ: "integer"},
+		"subnet_id":         textKey("subnet_id"),
+		"vpc_id":            textKey("vpc_id"),
+		"account_id":        textKey("account_id"),
+		"availability_zone": textKey("availability_zone"),
+	},
+	filters: map[string]string{
+		"subnet_id":         "subnet_id",
+		"vpc_id":            "vpc_id",
+		"account_id":        "account_id",
+		"availability_zone": "availability_zone",
+	},
+	tags:        true,
+	defaultSort: "id",
+}
+
+// ColorPage satisfies SelectAller for a page of colors
+type ColorPage struct {
+	query    PageQuery
+	cooldown time.Duration
+}
+
+// ColorList checks q against the keys colors are sorted and filtered by, the
+// state filter defaults to free colors, those past cooldown, and all drops it
+func ColorList(q PageQuery, cooldown time.Duration) (*ColorPage, error) {
+	filters := make(map[string]string, len(q.Filters)+1)
+	for k, v := range q.Filters {
+		filters[k] = v
+	}
+
+	state, ok := filters["state"]
+	switch {
+	case !ok:
+		filters["state"] = ColorStateFree
+	case state == ColorStateAll:
+		delete(filters, "state")
+	case !validColorState(state):
+		return nil, fmt.Errorf("%w: state must be one of %s", ErrInvalidPage, strings.Join(ColorStates, ", "))
+	}
+	q.Filters = filters
+
+	q, err := colorListing.check(q)
+	if err != nil {
+		return nil, err
+	}
+	return &ColorPage{query: q, cooldown: cooldown}, nil
+}
+
+func validColorState(state string) bool {
+	for _, s := range ColorStates {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+// FindAll selects the page
+func (p *ColorPage) FindAll(db *sqlx.DB) (*sqlx.Rows, error) {
+	sql, args := colorListing.query(p.query, p.cooldown.Seconds())
+	rows, err := db.Queryx(sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not select from colors: %s", err)
+	}
+	return rows, nil
+}
+
+// UnpackRows scans the page and returns the cursor of the next one
+func (p *ColorPage) UnpackRows(rows *sqlx.Rows) ([]Color, string, error) {
+	page := []struct {
+		Color
+		SortKey string `json:"sort_key"`
+	}{}
+	if err := sqlx.StructScan(rows, &page); err != nil {
+		return nil, "", fmt.Errorf("could not scan rows into slice %s", err)
+	}
+
+	n, next := p.query.next(len(page), func(i int) (string, int) { return page[i].SortKey, page[i].ID })
+	cs := make([]Color, n)
+	for i := range cs {
+		cs[i] = page[i].Color
+	}
+	return cs, next, nil
+}
+
+// InstancePage satisfies SelectAller for a page of the ec2 instances
+type InstancePage struct {
+	query PageQuery
+}
+
+// InstanceList checks q against the keys instances are sorted and filtered by
+func InstanceList(q PageQuery) (*InstancePage, error) {
+	q, err := instanceListing.check(q)
+	if err != nil {
+		return nil, err
+	}
+	return &InstancePage{query: q}, nil
+}
+
+// FindAll selects the page
+func (p *InstancePage) FindAll(db *sqlx.DB) (*sqlx.Rows, error) {
+	sql, args := instanceListing.query(p.query)
+	rows, err := db.Queryx(sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving instances: %s", err)
+	}
+	return rows, nil
+}
+
+// UnpackRows scans the page and returns the cursor of the next one
+func (p *InstancePage) UnpackRows(rows *sqlx.Rows) ([]Instance, string, error) {
+	page := []struct {
+		Instance
+		SortKey string `json:"sort_key"`
+	}{}
+	if err := sqlx.StructScan(rows, &page); err != nil {
+		return nil, "", fmt.Errorf("could not scan rows into slice %s", err)
+	}
+
+	n, next := p.query.next(len(page), func(i int) (string, int) { return page[i].SortKey, page[i].ID })
+	is := make([]Instance, n)
+	for i := range is {
+		is[i] = page[i].Instance
+	}
+	return is, next, nil
+}
+
+// SubnetPage satisfies SelectAller for a page of the subnets
+type SubnetPage struct {
+	query PageQuery
+}
+
+// SubnetList checks q against the keys subnets are sorted and filtered by
+func SubnetList(q PageQuery) (*SubnetPage, error) {
+	q, err := subnetListing.check(q)
+	if err != nil {
+		return nil, err
+	}
+	return &SubnetPage{query: q}, nil
+}
+
+// FindAll selects the page
+func (p *SubnetPage) FindAll(db *sqlx.DB) (*sqlx.Rows, error) {
+	sql, args := subnetListing.query(p.query)
+	rows, err := db.Queryx(sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not select from subnets: %s", err)
+	}
+	return rows, nil
+}
+
+// UnpackRows scans the page and returns the cursor of the next one
+func (p *SubnetPage) UnpackRows(rows *sqlx.Rows) ([]Subnet, string, error) {
+	page := []struct {
+		Subnet
+		SortKey string `json:"sort_key"`
+	}{}
+	if err := sqlx.StructScan(rows, &page); err != nil {
+		return nil, "", fmt.Errorf("could not scan rows into slice %s", err)
+	}
+
+	n, next := p.query.next(len(page), func(i int) (string, int) { return page[i].SortKey, page[i].ID })
+	ss := make([]Subnet, n)
+	for i := range ss {
+		ss[i] = page[i].Subnet
+	}
+	return ss, next, nil
+}
+
+// ListKeys are the sort keys and filters a list accepts
+type ListKeys struct {
+	Sorts   []string
+	Filters []string
+	Tags    bool
+}
+
+func (l listing) keys() ListKeys {
+	k := ListKeys{Tags: l.tags}
+	for key := range l.sorts {
+		k.Sorts = append(k.Sorts, key)
+	}
+	for key := range l.filters {
+		k.Filters = append(k.Filters, key)
+	}
+	sort.Strings(k.Sorts)
+	sort.Strings(k.Filters)
+	return k
+}
+
+// the keys of each list, for documentation
+var (
+	ColorListKeys    = colorListing.keys()
+	InstanceListKeys = instanceListing.keys()
+	SubnetListKeys   = subnetListing.keys()
+)
@@ -0,0 +1,146 @@
+package models
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestColorListPages(t *testing.T) {
+	mod, mock := initTestDB()
+	defer mod.Conn.Close()
+
+	cols := []string{"id", "name", "in_use", "state", "holder", "sort_key"}
+	mock.ExpectQuery(regexp.QuoteMeta(
+		`SELECT *, (name)::text AS sort_key FROM `+SQLColorStates+` WHERE state = $2 ORDER BY name ASC, id ASC LIMIT $3`)).
+		WithArgs(86400.0, "free", 3).
+		WillReturnRows(sqlmock.NewRows(cols).
+			AddRow(4, "amber", false, "free", "", "amber").
+			AddRow(2, "blue", false, "free", "", "blue").
+			AddRow(9, "cyan", false, "free", "", "cyan"))
+
+	page, err := ColorList(PageQuery{Limit: 2}, DefaultCooldown)
+	errCheck(err, t)
+
+	rows, err := mod.FindAll(page)
+	errCheck(err, t)
+
+	colors, next, err := page.UnpackRows(rows)
+	errCheck(err, t)
+
+	if len(colors) != 2 || colors[0].Name != "amber" || colors[1].Name != "blue" || colors[0].State != ColorStateFree {
+		t.Fatalf("expected amber and blue got %+v", colors)
+	}
+	if next == "" {
+		t.Fatalf("expected a next cursor")
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(
+		`SELECT *, (name)::text AS sort_key FROM `+SQLColorStates+` WHERE state = $2 AND (name, id) > ($3::text, $4) ORDER BY name ASC, id ASC LIMIT $5`)).
+		WithArgs(86400.0, "free", "blue", 2, 3).
+		WillReturnRows(sqlmock.NewRows(cols).
+			AddRow(9, "cyan", false, "free", "", "cyan"))
+
+	page, err = ColorList(PageQuery{Limit: 2, Cursor: next}, DefaultCooldown)
+	errCheck(err, t)
+
+	rows, err = mod.FindAll(page)
+	errCheck(err, t)
+
+	colors, next, err = page.UnpackRows(rows)
+	errCheck(err, t)
+
+	if len(colors) != 1 || next != "" {
+		t.Errorf("expected the last page got %+v and cursor %q", colors, next)
+	}
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there are unfulfilled expectations: %s", err)
+	}
+}
+
+func TestColorListStates(t *testing.T) {
+	mod, mock := initTestDB()
+	defer mod.Conn.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta(
+		`SELECT *, (id)::text AS sort_key FROM `+SQLColorStates+` ORDER BY id ASC, id ASC LIMIT $2`)).
+		WithArgs(0.0, DefaultPageLimit+1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "in_use", "state", "holder", "sort_key"}).
+			AddRow(1, "amber", true, "in_use", "i-0abc", "1").
+			AddRow(2, "blue", false, "free", "", "2"))
+
+	page, err := ColorList(PageQuery{Sort: "id", Filters: map[string]string{"state": ColorStateAll}}, 0)
+	errCheck(err, t)
+
+	rows, err := mod.FindAll(page)
+	errCheck(err, t)
+
+	colors, _, err := page.UnpackRows(rows)
+	errCheck(err, t)
+
+	if len(colors) != 2 || colors[0].Holder != "i-0abc" || colors[0].State != ColorStateInUse {
+		t.Errorf("expected every color and its holder got %+v", colors)
+	}
+
+	if _, err := ColorList(PageQuery{Filters: map[string]string{"state": "retired"}}, 0); !errors.Is(err, ErrInvalidPage) {
+		t.Errorf("expected an unknown state to fail got %v", err)
+	}
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there are unfulfilled expectations: %s", err)
+	}
+}
+
+func TestInstanceListFilters(t *testing.T) {
+	mod, mock := initTestDB()
+	defer mod.Conn.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta(
+		`SELECT *, (coalesce(tags -> 'color', ''))::text AS sort_key FROM ec2_instances WHERE tags -> 'role' = $1 AND tags -> $2 = $3 ORDER BY coalesce(tags -> 'color', '') DESC, id DESC LIMIT $4`)).
+		WithArgs("web", "team", "search", DefaultPageLimit+1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "instance_id", "account_id", "subnet_id", "tags", "sort_key"}).
+			AddRow(1, "i-1", "181657471068", "subnet-1", []byte(`"color"=>"orange"`), "orange"))
+
+	page, err := InstanceList(PageQuery{Sort: "-color", Filters: map[string]string{"role": "web", "tag.team": "search"}})
+	errCheck(err, t)
+
+	rows, err := mod.FindAll(page)
+	errCheck(err, t)
+
+	instances, next, err := page.UnpackRows(rows)
+	errCheck(err, t)
+
+	if len(instances) != 1 || instances[0].Tags.Map["color"].String != "orange" || next != "" {
+		t.Errorf("unexpected page %+v, cursor %q", instances, next)
+	}
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there are unfulfilled expectations: %s", err)
+	}
+}
+
+func TestPageQueryErrors(t *testing.T) {
+	other, err := SubnetList(PageQuery{Sort: "vpc_id", Limit: 1})
+	errCheck(err, t)
+	cursor := encodeCursor(cursor{Sort: other.query.Sort, Value: "vpc-1", ID: 1})
+
+	for name, q := range map[string]PageQuery{
+		"limit":        {Limit: MaxPageLimit + 1},
+		"sort":         {Sort: "tags"},
+		"filter":       {Filters: map[string]string{"in_use": "true"}},
+		"tag filter":   {Filters: map[string]string{"tag.": "x"}},
+		"cursor":       {Cursor: "not a cursor"},
+		"cursor order": {Sort: "subnet_id", Cursor: cursor},
+	} {
+		if _, err := SubnetList(q); !errors.Is(err, ErrInvalidPage) {
+			t.Errorf("%s: expected ErrInvalidPage got %v", name, err)
+		}
+	}
+
+	if _, err := ColorList(PageQuery{Filters: map[string]string{"tag.team": "web"}}, 0); !errors.Is(err, ErrInvalidPage) {
+		t.Errorf("expected colors to refuse tag filters got %v", err)
+	}
+}
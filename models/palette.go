@@ -0,0 +1,289 @@
+package models
+
+import (
+	"bufio"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// Fallback names what Get does when no color is free
+type Fallback string
+
+// the fallbacks a palette policy can use once the palette is exhausted
+const (
+	// FallbackNone fails the allocation with an ExhaustedError
+	FallbackNone Fallback = "none"
+	// FallbackOldest reuses the free color that was released longest ago,
+	// even though its cooldown has not passed
+	FallbackOldest Fallback = "oldest"
+	// FallbackSuffix adds a palette color with a numeric suffix, e.g. orange2
+	FallbackSuffix Fallback = "suffix"
+	// FallbackWords adds an unused word of a secondary word list
+	FallbackWords Fallback = "words"
+)
+
+// maxSuffix bounds the numeric suffixes tried for a single base color
+const maxSuffix = 99
+
+// ParseFallback turns none, oldest, suffix or words into a Fallback
+func ParseFallback(s string) (Fallback, error) {
+	switch f := Fallback(strings.ToLower(strings.TrimSpace(s))); f {
+	case "":
+		return FallbackNone, nil
+	case FallbackNone, FallbackOldest, FallbackSuffix, FallbackWords:
+		return f, nil
+	}
+	return FallbackNone, fmt.Errorf("unknown palette fallback %q", s)
+}
+
+// PalettePolicy decides what happens as the palette runs out of colors
+type PalettePolicy struct {
+	// Fallback is used when no color is free
+	Fallback Fallback
+	// Words is the secondary word list of FallbackWords
+	Words []string
+	// LowWater warns when fewer free colors than this remain, 0 disables it
+	LowWater int
+}
+
+// NewPalettePolicy returns a policy using fallback once the palette is
+// exhausted and warning below lowWater free colors
+func NewPalettePolicy(fallback Fallback, words []string, lowWater int) (*PalettePolicy, error) {
+	if fallback == FallbackWords && len(words) == 0 {
+		return nil, fmt.Errorf("palette fallback %q needs a word list", fallback)
+	}
+
+	for _, w := range words {
+		if err := ValidateColorName(w); err != nil {
+			return nil, err
+		}
+	}
+
+	// allocations see at most one less than the candidate limit remaining, a
+	// mark at or above it would warn on every allocation
+	if lowWater < 0 || lowWater >= CandidateLimit {
+		return nil, fmt.Errorf("palette low water mark %d must be between 0 and %d", lowWater, CandidateLimit-1)
+	}
+
+	return &PalettePolicy{Fallback: fallback, Words: words, LowWater: lowWater}, nil
+}
+
+// Low reports whether remaining free colors are below the low water mark
+func (p *PalettePolicy) Low(remaining int) bool {
+	return p != nil && p.LowWater > 0 && remaining < p.LowWater
+}
+
+// ReadWordList reads one word per line from path, skipping blank lines and
+// lines starting with #
+func ReadWordList(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open word list: %s", err)
+	}
+	defer f.Close()
+
+	words := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, strings.ToLower(line))
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read word list: %s", err)
+	}
+	return words, nil
+}
+
+// ErrPaletteExhausted matches every ExhaustedError with errors.Is
+var ErrPaletteExhausted = errors.New("palette exhausted")
+
+// ExhaustedError is returned by Get when no color can be handed out
+type ExhaustedError struct {
+	// Cooldown is the cooldown the allocation asked for
+	Cooldown time.Duration
+	// CoolingDown is how many colors will become free once rested
+	CoolingDown int
+	// Contended is how many rested colors were free but locked or taken by
+	// concurrent allocations
+	Contended int
+}
+
+// Error ...
+func (e *ExhaustedError) Error() string {
+	switch {
+	case e.CoolingDown > 0 && e.Contended > 0:
+		return fmt.Sprintf("no free colors: %d are within their %s cooldown and %d are held by concurrent allocations",
+			e.CoolingDown, e.Cooldown, e.Contended)
+	case e.CoolingDown > 0:
+		return fmt.Sprintf("no free colors: %d are within their %s cooldown", e.CoolingDown, e.Cooldown)
+	case e.Contended > 0:
+		return fmt.Sprintf("no free colors: %d are held by concurrent allocations", e.Contended)
+	}
+	return "no free colors: every color in the palette is in use or blocked"
+}
+
+// Is lets errors.Is(err, ErrPaletteExhausted) match
+func (e *ExhaustedError) Is(target error) bool {
+	return target == ErrPaletteExhausted
+}
+
+// Temporary reports whether colors will free up without intervention
+func (e *ExhaustedError) Temporary() bool {
+	return e.CoolingDown > 0 || e.Contended > 0
+}
+
+// WithPalettePolicy sets the fallback Get uses when no color is free
+func WithPalettePolicy(p *PalettePolicy) ColoConfigFun {
+	return func(c *Color) {
+		c.palette = p
+	}
+}
+
+// exhausted builds the error returned when the palette, and any fallback,
+// has nothing left
+func (c *Color) exhausted(tx *sqlx.Tx) error {
+	e := &ExhaustedError{Cooldown: c.Cooldown()}
+
+	// rested colors that were not picked are locked by or were taken by
+	// allocations running alongside this one
+	err := tx.QueryRowx(`
+		SELECT
+		count(*) FILTER (WHERE last_in_use > (NOW() - make_interval(secs => $1))) AS cooling_down,
+		count(*) FILTER (WHERE last_in_use <= (NOW() - make_interval(secs => $1))) AS contended
+		FROM colors WHERE in_use = false AND blocked = false`, c.Cooldown().Seconds()).Scan(&e.CoolingDown, &e.Contended)
+	if err != nil {
+		return fmt.Errorf("could not count cooling down colors: %s", err)
+	}
+
+	return e
+}
+
+// fallback picks a color with the palette policy's fallback, returning an
+// empty name when it found none
+func (c *Color) fallback(tx *sqlx.Tx) (string, error) {
+	if c.palette == nil {
+		return "", nil
+	}
+
+	switch c.palette.Fallback {
+	case FallbackOldest:
+		return c.fallbackOldest(tx)
+	case FallbackSuffix:
+		return c.fallbackSuffix(tx)
+	case FallbackWords:
+		return c.fallbackWords(tx)
+	}
+	return "", nil
+}
+
+func (c *Color) fallbackOldest(tx *sqlx.Tx) (string, error) {
+	var name string
+	var err error
+	if c.preview {
+		err = tx.Get(&name, `
+			SELECT name FROM colors
+			WHERE in_use = false AND blocked = false
+			AND NOT (name = ANY($1))
+			ORDER BY last_in_use ASC
+			LIMIT 1`, pq.Array(append([]string{}, c.siblings...)))
+	} else {
+		err = tx.Get(&name, `
+			SELECT name FROM colors
+			WHERE in_use = false AND blocked = false
+			ORDER BY last_in_use ASC
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED`)
+	}
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not select oldest color: %s", err)
+	}
+	return name, nil
+}
+
+func (c *Color) fallbackSuffix(tx *sqlx.Tx) (string, error) {
+	var base string
+	err := tx.Get(&base, `SELECT name FROM colors WHERE blocked = false ORDER BY random() LIMIT 1`)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not select base color: %s", err)
+	}
+
+	for n := 2; n <= maxSuffix; n++ {
+		name := fmt.Sprintf("%s%d", base, n)
+		if len(name) > MaxColorNameLen {
+			break
+		}
+
+		ok, err := c.addFallbackColor(tx, name)
+		if err != nil || ok {
+			return name, err
+		}
+	}
+	return "", nil
+}
+
+func (c *Color) fallbackWords(tx *sqlx.Tx) (string, error) {
+	for _, i := range rand.Perm(len(c.palette.Words)) {
+		name := c.palette.Words[i]
+
+		ok, err := c.addFallbackColor(tx, name)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			return name, nil
+		}
+	}
+	return "", nil
+}
+
+// addFallbackColor adds name to the palette, a dry run only checks that it
+// could be added
+func (c *Color) addFallbackColor(tx *sqlx.Tx, name string) (bool, error) {
+	if !c.preview {
+		return insertFallbackColor(tx, name)
+	}
+	if c.previewed(name) {
+		return false, nil
+	}
+
+	var exists bool
+	if err := tx.Get(&exists, `SELECT EXISTS (SELECT 1 FROM colors WHERE name = $1)`, name); err != nil {
+		return false, fmt.Errorf("could not check fallback color %s: %s", name, err)
+	}
+	return !exists, nil
+}
+
+// insertFallbackColor adds name to the palette for Get to claim, reporting
+// false when the name is taken
+func insertFallbackColor(tx *sqlx.Tx, name string) (bool, error) {
+	var inserted string
+	err := tx.Get(&inserted, `
+		INSERT INTO colors (name, in_use, last_in_use) VALUES ($1, false, NOW())
+		ON CONFLICT (name) DO NOTHING
+		RETURNING name`, name)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("could not add fallback color %s: %s", name, err)
+	}
+	return true, nil
+}
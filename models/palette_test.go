@@ -0,0 +1,102 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestParseFallback(t *testing.T) {
+	for in, want := range map[string]Fallback{"": FallbackNone, "Oldest": FallbackOldest, "words": FallbackWords} {
+		got, err := ParseFallback(in)
+		errCheck(err, t)
+		if got != want {
+			t.Errorf("%q: expected %s got: %s", in, want, got)
+		}
+	}
+
+	if _, err := ParseFallback("recycle"); err == nil {
+		t.Errorf("expected unknown fallback to fail")
+	}
+
+	if _, err := NewPalettePolicy(FallbackWords, nil, 0); err == nil {
+		t.Errorf("expected words fallback without a word list to fail")
+	}
+
+	if _, err := NewPalettePolicy(FallbackNone, nil, CandidateLimit); err == nil {
+		t.Errorf("expected a low water mark the candidate limit can't report to fail")
+	}
+
+	p, err := NewPalettePolicy(FallbackNone, nil, 10)
+	errCheck(err, t)
+	if !p.Low(9) || p.Low(10) {
+		t.Errorf("expected low water of 10 to warn below 10")
+	}
+}
+
+func TestGetFallsBackToOldestColor(t *testing.T) {
+	mod, mock := initTestDB()
+	defer mod.Conn.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT .* FROM colors").
+		WillReturnRows(sqlmock.NewRows(returnColorCols()))
+	mock.ExpectQuery("SELECT name FROM colors.*ORDER BY last_in_use ASC").
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("orange"))
+	mock.ExpectExec("UPDATE colors SET .*").
+		WithArgs("orange").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery("SELECT .*").
+		WithArgs("orange").
+		WillReturnRows(sqlmock.NewRows(returnColorCols()).AddRow(1, "orange", true, time.Now()))
+
+	color, err := NewColor(WithPalettePolicy(&PalettePolicy{Fallback: FallbackOldest}))
+	errCheck(err, t)
+
+	errCheck(color.Get(mod.Conn), t)
+
+	if color.Name != "orange" || !color.FellBack() {
+		t.Errorf("expected orange from the fallback got: %s fell back %t", color.Name, color.FellBack())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there are unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetFallsBackToWordList(t *testing.T) {
+	mod, mock := initTestDB()
+	defer mod.Conn.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT .* FROM colors").
+		WillReturnRows(sqlmock.NewRows(returnColorCols()))
+	mock.ExpectQuery("INSERT INTO colors").
+		WithArgs("walnut").
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("walnut"))
+	mock.ExpectExec("UPDATE colors SET .*").
+		WithArgs("walnut").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery("SELECT .*").
+		WithArgs("walnut").
+		WillReturnRows(sqlmock.NewRows(returnColorCols()).AddRow(9, "walnut", true, time.Now()))
+
+	policy, err := NewPalettePolicy(FallbackWords, []string{"walnut"}, 0)
+	errCheck(err, t)
+
+	color, err := NewColor(WithPalettePolicy(policy))
+	errCheck(err, t)
+
+	errCheck(color.Get(mod.Conn), t)
+
+	if color.Name != "walnut" {
+		t.Errorf("expected walnut from the word list got: %s", color.Name)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there are unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,374 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// RegistryKind names a registry and the table it is stored in
+type RegistryKind string
+
+// the registries host names are built from
+const (
+	Environments RegistryKind = "environments"
+	Roles        RegistryKind = "roles"
+	Pools        RegistryKind = "pools"
+)
+
+// RegistryKinds lists every registry
+var RegistryKinds = []RegistryKind{Environments, Roles, Pools}
+
+// MaxShortCodeLen bounds the short codes used in host names
+const MaxShortCodeLen = 8
+
+// ErrEntryNotFound is returned when a name is not registered
+var ErrEntryNotFound = errors.New("registry entry not found")
+
+// ErrEntryExists is returned when a name or short code is already registered
+var ErrEntryExists = errors.New("registry entry already exists")
+
+// ErrEntryInUse is returned when an entry is part of an allowed combination
+var ErrEntryInUse = errors.New("registry entry is used by an allowed combination")
+
+// RegistryEntry is a registered environment, role or pool
+type RegistryEntry struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	ShortCode string    `json:"short_code"`
+	Owner     string    `json:"owner"`
+	CreatedAt time.Time `json:"created_at"`
+	kind      RegistryKind
+}
+
+// RegistryEntryConfigFun type allows function option configuration
+type RegistryEntryConfigFun func(*RegistryEntry)
+
+// NewRegistryEntry constructor for an entry of the kind registry
+func NewRegistryEntry(kind RegistryKind, opts ...func(*RegistryEntry)) *RegistryEntry {
+	e := &RegistryEntry{kind: kind}
+
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	return e
+}
+
+// WithEntryName sets the name of the entry
+func WithEntryName(name string) RegistryEntryConfigFun {
+	return func(e *RegistryEntry) {
+		e.Name = name
+	}
+}
+
+// WithShortCode sets the code used for the entry in host names
+func WithShortCode(code string) RegistryEntryConfigFun {
+	return func(e *RegistryEntry) {
+		e.ShortCode = code
+	}
+}
+
+// WithEntryOwner sets the owner of the entry
+func WithEntryOwner(owner string) RegistryEntryConfigFun {
+	return func(e *RegistryEntry) {
+		e.Owner = owner
+	}
+}
+
+// Kind returns the registry the entry belongs to
+func (e *RegistryEntry) Kind() RegistryKind {
+	return e.kind
+}
+
+// ParseRegistryKind turns environments, roles or pools into a RegistryKind
+func ParseRegistryKind(s string) (RegistryKind, error) {
+	for _, k := range RegistryKinds {
+		if string(k) == s {
+			return k, nil
+		}
+	}
+	return "", fmt.Errorf("unknown registry %q", s)
+}
+
+// Validate checks the name is a dns label and the short code can stand for
+// it inside a host name, short codes can't hold the hyphens separating the
+// parts of a name
+func (e *RegistryEntry) Validate() error {
+	if e.Name == "" || len(e.Name) > MaxColorNameLen {
+		return fmt.Errorf("name must be between 1 and %d characters", MaxColorNameLen)
+	}
+
+	for i, r := range e.Name {
+		switch {
+		case r >= 'a' && r <= 'z':
+		case r >= '0' && r <= '9' && i > 0:
+		case r == '-' && i > 0 && i < len(e.Name)-1:
+		default:
+			return fmt.Errorf("name %q must be lower case letters, digits and inner hyphens, starting with a letter", e.Name)
+		}
+	}
+
+	if e.ShortCode == "" || len(e.ShortCode) > MaxShortCodeLen {
+		return fmt.Errorf("short_code must be between 1 and %d characters", MaxShortCodeLen)
+	}
+
+	for _, r := range e.ShortCode {
+		if !(r >= 'a' && r <= 'z') && !(r >= '0' && r <= '9') {
+			return fmt.Errorf("short_code %q must only contain lower case letters and digits", e.ShortCode)
+		}
+	}
+
+	return nil
+}
+
+// Get statisfies the Getter interface, it finds the entry by name
+func (e *RegistryEntry) Get(db *sqlx.DB) error {
+	err := db.QueryRowx(fmt.Sprintf("SELECT * from %s where name = $1", e.kind), e.Name).StructScan(e)
+	if err == sql.ErrNoRows {
+		return ErrEntryNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("could not select from %s: %s", e.kind, err)
+	}
+	return nil
+}
+
+// FindAll returns every entry of the registry ordered by name
+func (e *RegistryEntry) FindAll(db *sqlx.DB) (*sqlx.Rows, error) {
+	rows, err := db.Queryx(fmt.Sprintf("SELECT * from %s ORDER BY name", e.kind))
+	if err != nil {
+		return nil, fmt.Errorf("could not select from %s: %s", e.kind, err)
+	}
+	return rows, nil
+}
+
+// UnpackRows takes a sql.Rows and scans into a struct slice
+func (e *RegistryEntry) UnpackRows(rows *sqlx.Rows) ([]RegistryEntry, error) {
+	es := []RegistryEntry{}
+
+	if err := sqlx.StructScan(rows, &es); err != nil {
+		return nil, fmt.Errorf("could not scan rows into slice %s", err)
+	}
+
+	return es, nil
+}
+
+// Create registers the entry and returns its id
+func (e *RegistryEntry) Create(db *sqlx.DB) (string, error) {
+	insert := fmt.Sprintf(`
+		INSERT INTO %s (name, short_code, owner)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at`, e.kind)
+
+	err := db.QueryRowx(insert, e.Name, e.ShortCode, e.Owner).Scan(&e.ID, &e.CreatedAt)
+	if isUniqueViolation(err) {
+		return "", ErrEntryExists
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not insert into %s: %s", e.kind, err)
+	}
+
+	return fmt.Sprintf("%d", e.ID), nil
+}
+
+// Update changes the short code and owner of the named entry
+func (e *RegistryEntry) Update(db *sqlx.DB) error {
+	update := fmt.Sprintf(`UPDATE %s SET short_code = $1, owner = $2 WHERE name = $3 RETURNING *`, e.kind)
+
+	err := db.QueryRowx(update, e.ShortCode, e.Owner, e.Name).StructScan(e)
+	if err == sql.ErrNoRows {
+		return ErrEntryNotFound
+	}
+	if isUniqueViolation(err) {
+		return ErrEntryExists
+	}
+	if err != nil {
+		return fmt.Errorf("could not update %s: %s", e.kind, err)
+	}
+	return nil
+}
+
+// Delete removes the named entry, entries used by an allowed combination are
+// refused with ErrEntryInUse
+func (e *RegistryEntry) Delete(db *sqlx.DB) error {
+	res, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE name = $1", e.kind), e.Name)
+	if isForeignKeyViolation(err) {
+		return ErrEntryInUse
+	}
+	if err != nil {
+		return fmt.Errorf("could not delete from %s: %s", e.kind, err)
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrEntryNotFound
+	}
+	return nil
+}
+
+// Combination is an allowed environment, role and pool triple
+type Combination struct {
+	Environment string `json:"environment"`
+	Role        string `json:"role"`
+	Pool        string `json:"pool"`
+}
+
+// Get statisfies the Getter interface, it fails with ErrEntryNotFound when
+// the combination is not allowed
+func (c *Combination) Get(db *sqlx.DB) error {
+	err := db.QueryRowx(`SELECT * from combinations where environment = $1 and role = $2 and pool = $3`,
+		c.Environment, c.Role, c.Pool).StructScan(c)
+	if err == sql.ErrNoRows {
+		return ErrEntryNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("could not select from combinations: %s", err)
+	}
+	return nil
+}
+
+// FindAll returns every allowed combination
+func (c *Combination) FindAll(db *sqlx.DB) (*sqlx.Rows, error) {
+	rows, err := db.Queryx(`SELECT * from combinations ORDER BY environment, role, pool`)
+	if err != nil {
+		return nil, fmt.Errorf("could not select from combinations: %s", err)
+	}
+	return rows, nil
+}
+
+// UnpackRows takes a sql.Rows and scans into a struct slice
+func (c *Combination) UnpackRows(rows *sqlx.Rows) ([]Combination, error) {
+	cs := []Combination{}
+
+	if err := sqlx.StructScan(rows, &cs); err != nil {
+		return nil, fmt.Errorf("could not scan rows into slice %s", err)
+	}
+
+	return cs, nil
+}
+
+// Create allows the combination, each part must be registered
+func (c *Combination) Create(db *sqlx.DB) (string, error) {
+	_, err := db.Exec(`INSERT INTO combinations (environment, role, pool) VALUES ($1, $2, $3)`,
+		c.Environment, c.Role, c.Pool)
+	if isUniqueViolation(err) {
+		return "", ErrEntryExists
+	}
+	if isForeignKeyViolation(err) {
+		return "", ErrEntryNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not insert into combinations: %s", err)
+	}
+
+	return c.Environment + "/" + c.Role + "/" + c.Pool, nil
+}
+
+// Delete disallows the combination
+func (c *Combination) Delete(db *sqlx.DB) error {
+	res, err := db.Exec(`DELETE FROM combinations WHERE environment = $1 and role = $2 and pool = $3`,
+		c.Environment, c.Role, c.Pool)
+	if err != nil {
+		return fmt.Errorf("could not delete from combinations: %s", err)
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrEntryNotFound
+	}
+	return nil
+}
+
+// Registry is a snapshot of every registry used to name hosts
+type Registry struct {
+	Entries      map[RegistryKind]map[string]RegistryEntry
+	Combinations []Combination
+}
+
+// LoadRegistry reads every registry and allowed combination
+func LoadRegistry(db *sqlx.DB) (*Registry, error) {
+	reg := &Registry{Entries: make(map[RegistryKind]map[string]RegistryEntry)}
+
+	for _, kind := range RegistryKinds {
+		es := []RegistryEntry{}
+		if err := db.Select(&es, fmt.Sprintf("SELECT * from %s", kind)); err != nil {
+			return nil, fmt.Errorf("could not select from %s: %s", kind, err)
+		}
+
+		reg.Entries[kind] = make(map[string]RegistryEntry, len(es))
+		for _, e := range es {
+			reg.Entries[kind][e.Name] = e
+		}
+	}
+
+	if err := db.Select(&reg.Combinations, `SELECT * from combinations`); err != nil {
+		return nil, fmt.Errorf("could not select from combinations: %s", err)
+	}
+
+	return reg, nil
+}
+
+// Lookup returns the registered entry, a registry with no entries allows
+// every name and reports it as found with no short code
+func (r *Registry) Lookup(kind RegistryKind, name string) (RegistryEntry, bool) {
+	entries := r.Entries[kind]
+	if len(entries) == 0 {
+		return RegistryEntry{Name: name, kind: kind}, true
+	}
+
+	e, ok := entries[name]
+	return e, ok
+}
+
+// Names returns the registered names of kind in order
+func (r *Registry) Names(kind RegistryKind) []string {
+	names := make([]string, 0, len(r.Entries[kind]))
+	for name := range r.Entries[kind] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Allows reports whether the combination may be used. Roles with no
+// combinations registered may be used in any environment and pool
+func (r *Registry) Allows(c Combination) bool {
+	restricted := false
+	for _, allowed := range r.Combinations {
+		if allowed.Role != c.Role {
+			continue
+		}
+		restricted = true
+		if allowed == c {
+			return true
+		}
+	}
+	return !restricted
+}
+
+// Code returns the short code of a name for use in host names. Names that
+// are not registered keep the form names had before the registry: the whole
+// role, or the first letter of an environment or pool
+func (r *Registry) Code(kind RegistryKind, name string) string {
+	if e, ok := r.Entries[kind][name]; ok && e.ShortCode != "" {
+		return e.ShortCode
+	}
+	if kind == Roles || name == "" {
+		return name
+	}
+	return name[:1]
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+func isForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503"
+}
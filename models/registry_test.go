@@ -0,0 +1,77 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func testRegistry() *Registry {
+	return &Registry{
+		Entries: map[RegistryKind]map[string]RegistryEntry{
+			Environments: {
+				"staging": {Name: "staging", ShortCode: "stg"},
+				"sandbox": {Name: "sandbox", ShortCode: "sbx"},
+			},
+			Roles: {},
+			Pools: {"blue": {Name: "blue", ShortCode: "b"}},
+		},
+		Combinations: []Combination{{Environment: "staging", Role: "db", Pool: "blue"}},
+	}
+}
+
+func TestRegistryCodes(t *testing.T) {
+	reg := testRegistry()
+
+	if a, b := reg.Code(Environments, "staging"), reg.Code(Environments, "sandbox"); a == b {
+		t.Errorf("expected staging and sandbox to have distinct codes got: %s %s", a, b)
+	}
+
+	if got := reg.Code(Roles, "web"); got != "web" {
+		t.Errorf("expected an unregistered role to keep its name got: %s", got)
+	}
+
+	if _, ok := reg.Lookup(Environments, "prod"); ok {
+		t.Errorf("expected prod to be unregistered")
+	}
+
+	if _, ok := reg.Lookup(Roles, "anything"); !ok {
+		t.Errorf("expected an empty registry to allow any name")
+	}
+
+	if reg.Allows(Combination{Environment: "sandbox", Role: "db", Pool: "blue"}) {
+		t.Errorf("expected db to be restricted to its combinations")
+	}
+
+	if !reg.Allows(Combination{Environment: "sandbox", Role: "web", Pool: "blue"}) {
+		t.Errorf("expected a role without combinations to be allowed anywhere")
+	}
+}
+
+func TestRegistryEntryCreateConflict(t *testing.T) {
+	mod, mock := initTestDB()
+	defer mod.Conn.Close()
+
+	mock.ExpectQuery("INSERT INTO environments").
+		WithArgs("staging", "stg", "platform").
+		WillReturnError(&pq.Error{Code: "23505"})
+
+	entry := NewRegistryEntry(Environments,
+		WithEntryName("staging"),
+		WithShortCode("stg"),
+		WithEntryOwner("platform"),
+	)
+	errCheck(entry.Validate(), t)
+
+	if _, err := mod.Create(entry); err != ErrEntryExists {
+		t.Errorf("expected entry exists got: %v", err)
+	}
+
+	if err := NewRegistryEntry(Pools, WithEntryName("blue"), WithShortCode("b-1")).Validate(); err == nil {
+		t.Errorf("expected a short code with a hyphen to fail")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there are unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,184 @@
+package models
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+)
+
+// Strategy names how Get chooses between free colors
+type Strategy string
+
+// the strategies a Selector can use
+const (
+	// StrategyRandom picks uniformly at random
+	StrategyRandom Strategy = "random"
+	// StrategyLRU picks the color released longest ago
+	StrategyLRU Strategy = "lru"
+	// StrategyAlphabetical picks the first color by name
+	StrategyAlphabetical Strategy = "alphabetical"
+	// StrategySeeded orders the whole free set by a hash of each name salted
+	// from a seeded generator, the same seed and palette give the same
+	// sequence of colors
+	StrategySeeded Strategy = "seeded"
+	// StrategyDissimilar picks the color least like the colors already used
+	// by the role and pool being allocated
+	StrategyDissimilar Strategy = "dissimilar"
+)
+
+// ParseStrategy turns random, lru, alphabetical, seeded or dissimilar into a
+// Strategy
+func ParseStrategy(s string) (Strategy, error) {
+	switch st := Strategy(strings.ToLower(strings.TrimSpace(s))); st {
+	case "":
+		return StrategyRandom, nil
+	case StrategyRandom, StrategyLRU, StrategyAlphabetical, StrategySeeded, StrategyDissimilar:
+		return st, nil
+	}
+	return StrategyRandom, fmt.Errorf("unknown color strategy %q", s)
+}
+
+// Selector chooses a color from the free candidates with its strategy, it is
+// shared between allocations so a seeded sequence carries on across them
+type Selector struct {
+	Strategy Strategy
+
+	mu    sync.Mutex
+	seed  int64
+	draws int64
+}
+
+// NewSelector returns a selector for strategy, seed is only used by
+// StrategySeeded
+func NewSelector(strategy Strategy, seed int64) *Selector {
+	return &Selector{
+		Strategy: strategy,
+		seed:     seed,
+	}
+}
+
+// orderBy is the ORDER BY of the candidate query, strategies picking the
+// first candidate rely on it entirely. A seeded order salts each name with the
+// next draw of the sequence, so the database shuffles every free color rather
+// than only the first CandidateLimit by name. A preview reads the draw ahead
+// places past the next one without using it up, so the real allocation that
+// follows gets the same colors
+func (s *Selector) orderBy(preview bool, ahead int) string {
+	if s == nil {
+		return "random()"
+	}
+
+	switch s.Strategy {
+	case StrategyLRU:
+		return "last_in_use ASC, name"
+	case StrategyAlphabetical:
+		return "name"
+	case StrategySeeded:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		draw := s.draws + int64(ahead)
+		if !preview {
+			s.draws++
+		}
+		return fmt.Sprintf("md5(name || '%d'), name", seededSalt(s.seed, draw))
+	}
+	return "random()"
+}
+
+// seededSalt is the nth draw of the sequence of seed, each draw has a
+// generator of its own so reading one never moves another
+func seededSalt(seed, n int64) int64 {
+	return rand.New(rand.NewSource(seed + n)).Int63()
+}
+
+// needsPeers reports whether pick uses the colors of the role and pool
+func (s *Selector) needsPeers() bool {
+	return s != nil && s.Strategy == StrategyDissimilar
+}
+
+// pick returns the name of the chosen candidate, candidates must not be empty
+func (s *Selector) pick(candidates []Color, peers []string) string {
+	if s == nil {
+		return candidates[rand.Intn(len(candidates))].Name
+	}
+
+	switch s.Strategy {
+	case StrategyLRU, StrategyAlphabetical, StrategySeeded:
+		return candidates[0].Name
+	case StrategyDissimilar:
+		return mostDissimilar(candidates, peers)
+	}
+	return candidates[rand.Intn(len(candidates))].Name
+}
+
+// mostDissimilar returns the candidate whose closest peer is furthest away.
+// Candidates arrive in random order so ties are broken at random
+func mostDissimilar(candidates []Color, peers []string) string {
+	best, bestScore := candidates[0].Name, -1.0
+
+	for _, c := range candidates {
+		score := 1.0
+		for _, p := range peers {
+			if d := nameDistance(c.Name, p); d < score {
+				score = d
+			}
+		}
+
+		if score > bestScore {
+			best, bestScore = c.Name, score
+		}
+	}
+
+	return best
+}
+
+// nameDistance is the edit distance of a and b, compared over the length of
+// the shorter name so a shared prefix such as amber and amberwaves counts as
+// near identical, scaled to 0 for equal and 1 for entirely different
+func nameDistance(a, b string) float64 {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	if n == 0 {
+		return 1
+	}
+
+	return float64(levenshtein(a[:n], b[:n])) / float64(n)
+}
+
+// levenshtein counts the single byte insertions, deletions and substitutions
+// turning a into b
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
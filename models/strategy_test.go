@@ -0,0 +1,164 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func candidates(names ...string) []Color {
+	cs := make([]Color, len(names))
+	for i, n := range names {
+		cs[i] = Color{Name: n}
+	}
+	return cs
+}
+
+func TestSeededSelectorIsDeterministic(t *testing.T) {
+	a, b := NewSelector(StrategySeeded, 42), NewSelector(StrategySeeded, 42)
+	seen := map[string]bool{}
+	for i := 0; i < 10; i++ {
+		x, y := a.orderBy(false, 0), b.orderBy(false, 0)
+		if x != y {
+			t.Fatalf("draw %d: expected equal seeds to agree got: %s and %s", i, x, y)
+		}
+		if !strings.HasPrefix(x, "md5(name || ") {
+			t.Fatalf("expected the seeded order to hash every free name got: %s", x)
+		}
+		seen[x] = true
+	}
+
+	if len(seen) < 2 {
+		t.Errorf("expected successive draws to reshuffle the free colors")
+	}
+}
+
+func TestGetSeededSamplesWholeFreeSet(t *testing.T) {
+	mod, mock := initTestDB()
+	defer mod.Conn.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT .* FROM colors.*ORDER BY md5\(name \|\| '-?[0-9]+'\), name`).
+		WillReturnRows(sqlmock.NewRows(returnColorCols()).
+			AddRow(1, "teal", false, time.Now()).
+			AddRow(2, "amber", false, time.Now()))
+	mock.ExpectExec("UPDATE colors SET .*").
+		WithArgs("teal").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery("SELECT .*").
+		WithArgs("teal").
+		WillReturnRows(sqlmock.NewRows(returnColorCols()).AddRow(1, "teal", true, time.Now()))
+
+	color, err := NewColor(WithSelector(NewSelector(StrategySeeded, 7)))
+	errCheck(err, t)
+
+	errCheck(color.Get(mod.Conn), t)
+
+	if color.Name != "teal" {
+		t.Errorf("expected the first color in hashed order got: %s", color.Name)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there are unfulfilled expectations: %s", err)
+	}
+}
+
+func TestDissimilarSelectorAvoidsPeers(t *testing.T) {
+	s := NewSelector(StrategyDissimilar, 0)
+
+	got := s.pick(candidates("amberwaves", "ambers", "violet"), []string{"amber"})
+	if got != "violet" {
+		t.Errorf("expected violet to be furthest from amber got: %s", got)
+	}
+
+	if d := nameDistance("amber", "amberwaves"); d != 0 {
+		t.Errorf("expected a shared prefix to count as identical got: %f", d)
+	}
+
+	if d := levenshtein("kitten", "sitting"); d != 3 {
+		t.Errorf("expected distance 3 got: %d", d)
+	}
+}
+
+func TestGetUsesSelectorOrdering(t *testing.T) {
+	mod, mock := initTestDB()
+	defer mod.Conn.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT .* FROM colors.*ORDER BY name").
+		WillReturnRows(sqlmock.NewRows(returnColorCols()).
+			AddRow(1, "amber", false, time.Now()).
+			AddRow(2, "blue", false, time.Now()))
+	mock.ExpectExec("UPDATE colors SET .*").
+		WithArgs("amber").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery("SELECT .*").
+		WithArgs("amber").
+		WillReturnRows(sqlmock.NewRows(returnColorCols()).AddRow(1, "amber", true, time.Now()))
+
+	color, err := NewColor(WithSelector(NewSelector(StrategyAlphabetical, 0)))
+	errCheck(err, t)
+
+	errCheck(color.Get(mod.Conn), t)
+
+	if color.Name != "amber" {
+		t.Errorf("expected amber first alphabetically got: %s", color.Name)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there are unfulfilled expectations: %s", err)
+	}
+}
+
+func TestSeededPreviewLeavesSequenceAlone(t *testing.T) {
+	mod, mock := initTestDB()
+	defer mod.Conn.Close()
+
+	// the database orders by the salted hash, the mock only answers queries
+	// carrying the first draw of the sequence
+	first := regexp.QuoteMeta("ORDER BY " + NewSelector(StrategySeeded, 7).orderBy(false, 0))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM colors.*NOT \(name = ANY\(\$3\)\).*` + first).
+		WillReturnRows(sqlmock.NewRows(returnColorCols()).AddRow(1, "teal", false, time.Now()))
+	mock.ExpectQuery("SELECT .* from colors where name").
+		WithArgs("teal").
+		WillReturnRows(sqlmock.NewRows(returnColorCols()).AddRow(1, "teal", false, time.Now()))
+	mock.ExpectRollback()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM colors.*` + first).
+		WillReturnRows(sqlmock.NewRows(returnColorCols()).AddRow(1, "teal", false, time.Now()))
+	mock.ExpectExec("UPDATE colors SET .*").
+		WithArgs("teal").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery("SELECT .*").
+		WithArgs("teal").
+		WillReturnRows(sqlmock.NewRows(returnColorCols()).AddRow(1, "teal", true, time.Now()))
+
+	selector := NewSelector(StrategySeeded, 7)
+
+	preview, err := NewColor(WithSelector(selector))
+	errCheck(err, t)
+	alloc := NewAllocation(WithDryRun(true))
+	alloc.Add(preview, "181657471068", "web-team")
+	errCheck(alloc.Get(mod.Conn), t)
+
+	color, err := NewColor(WithSelector(selector))
+	errCheck(err, t)
+	errCheck(color.Get(mod.Conn), t)
+
+	if preview.Name != color.Name {
+		t.Errorf("expected the preview to pick what the allocation gets got: %s and %s", preview.Name, color.Name)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there are unfulfilled expectations: %s", err)
+	}
+}
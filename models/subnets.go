@@ -2,6 +2,7 @@ package models
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 
@@ -19,6 +20,9 @@ type Subnet struct {
 	VpcID     string        `json:"vpc_id" db:"vpc_id"`
 }
 
+// ErrSubnetNotFound is returned when no subnet has the subnet id looked up
+var ErrSubnetNotFound = errors.New("subnet not found")
+
 // SubnetConfigFun type allows function option configuration
 type SubnetConfigFun func(*Subnet)
 
@@ -60,6 +64,9 @@ func (s *Subnet) Create(db *sqlx.DB) error {
 func (s *Subnet) Get(db *sqlx.DB) error {
 
 	err := db.QueryRowx("SELECT * from subnets where subnet_id = $1", s.SubnetID).StructScan(s)
+	if err == sql.ErrNoRows {
+		return ErrSubnetNotFound
+	}
 
 	if err != nil {
 		return fmt.Errorf("could not find subnet %v", err)
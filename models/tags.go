@@ -0,0 +1,145 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/mleone896/inventory/api"
+	"github.com/mleone896/inventory/awstags"
+)
+
+// the tags every allocated host carries, rules can't override them
+const (
+	TagName        = "Name"
+	TagColor       = "color"
+	TagOwner       = "owner"
+	TagRole        = "role"
+	TagEnvironment = "environment"
+	TagPool        = "pool"
+)
+
+// HostTags describes an allocated host the tags are generated for
+type HostTags struct {
+	Name        string
+	Color       string
+	Owner       string
+	Environment string
+	Role        string
+	Pool        string
+	AccountID   string
+}
+
+// TagRule adds Tags to the hosts it matches, an empty field matches any value
+type TagRule struct {
+	Environment string            `json:"environment,omitempty"`
+	Role        string            `json:"role,omitempty"`
+	Pool        string            `json:"pool,omitempty"`
+	AccountID   string            `json:"account_id,omitempty"`
+	Tags        map[string]string `json:"tags"`
+}
+
+// matches reports whether every field set on the rule equals the host's
+func (r TagRule) matches(h HostTags) bool {
+	for _, f := range []struct{ want, got string }{
+		{r.Environment, h.Environment},
+		{r.Role, h.Role},
+		{r.Pool, h.Pool},
+		{r.AccountID, h.AccountID},
+	} {
+		if f.want != "" && f.want != f.got {
+			return false
+		}
+	}
+	return true
+}
+
+// TagPolicy generates the extra tags of a host from its rules, rules are
+// applied in order so later rules override the values of earlier ones
+type TagPolicy struct {
+	Rules []TagRule `json:"rules"`
+}
+
+// LoadTagPolicy reads the rules from a json file
+func LoadTagPolicy(path string) (*TagPolicy, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read tag policy: %s", err)
+	}
+
+	p := &TagPolicy{}
+	if err := json.Unmarshal(b, p); err != nil {
+		return nil, fmt.Errorf("could not parse tag policy: %s", err)
+	}
+
+	// values can grow once expanded and are checked when hosts are allocated
+	// but keys aws would never accept are refused up front
+	for i, rule := range p.Rules {
+		_, v, _ := awstags.NewChecker(awstags.Reject).Tags(rule.Tags)
+		for _, e := range v {
+			if e.Rule != awstags.RuleValueLength {
+				return nil, fmt.Errorf("rule %d: %s %s", i, e.Field, e.Message)
+			}
+		}
+	}
+
+	return p, nil
+}
+
+// Tags returns the full tag set of the host: the tags every host carries and
+// those of every matching rule. Rule values may reference the host as
+// {environment}, {role}, {pool}, {color}, {owner}, {account_id} or {name}
+func (p *TagPolicy) Tags(h HostTags) map[string]string {
+	expand := strings.NewReplacer(
+		"{name}", h.Name,
+		"{color}", h.Color,
+		"{owner}", h.Owner,
+		"{environment}", h.Environment,
+		"{role}", h.Role,
+		"{pool}", h.Pool,
+		"{account_id}", h.AccountID,
+	)
+
+	tags := make(map[string]string)
+	if p != nil {
+		for _, rule := range p.Rules {
+			if !rule.matches(h) {
+				continue
+			}
+			for key, value := range rule.Tags {
+				tags[key] = expand.Replace(value)
+			}
+		}
+	}
+
+	tags[TagName] = h.Name
+	tags[TagColor] = h.Color
+	tags[TagOwner] = h.Owner
+	tags[TagRole] = h.Role
+	tags[TagEnvironment] = h.Environment
+	if h.Pool != "" {
+		tags[TagPool] = h.Pool
+	}
+
+	return tags
+}
+
+// EC2Tag is a tag in the form EC2 CreateTags accepts
+type EC2Tag = api.EC2Tag
+
+// EC2Tags returns tags as a list for EC2 CreateTags, ordered by key
+func EC2Tags(tags map[string]string) []EC2Tag {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	out := make([]EC2Tag, len(keys))
+	for i, key := range keys {
+		out[i] = EC2Tag{Key: key, Value: tags[key]}
+	}
+	return out
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"testing"
+)
+
+func TestTagPolicyTags(t *testing.T) {
+	p := &TagPolicy{Rules: []TagRule{
+		{Tags: map[string]string{"patch-group": "{environment}-{role}", "backup-schedule": "weekly"}},
+		{Environment: "prod", Tags: map[string]string{"backup-schedule": "daily", "compliance-tier": "tier-1"}},
+		{Role: "db", Environment: "staging", Tags: map[string]string{"backup-schedule": "hourly"}},
+		{Tags: map[string]string{TagColor: "not-a-color"}},
+	}}
+
+	tags := p.Tags(HostTags{
+		Name:        "p-web-b-orange-1a",
+		Color:       "orange",
+		Owner:       "web-team",
+		Environment: "prod",
+		Role:        "web",
+		Pool:        "blue",
+	})
+
+	expected := map[string]string{
+		TagName:           "p-web-b-orange-1a",
+		TagColor:          "orange",
+		TagOwner:          "web-team",
+		TagRole:           "web",
+		TagEnvironment:    "prod",
+		TagPool:           "blue",
+		"patch-group":     "prod-web",
+		"backup-schedule": "daily",
+		"compliance-tier": "tier-1",
+	}
+
+	if len(tags) != len(expected) {
+		t.Errorf("expected %d tags got %d: %v", len(expected), len(tags), tags)
+	}
+	for key, value := range expected {
+		if tags[key] != value {
+			t.Errorf("expected %s=%s got %s", key, value, tags[key])
+		}
+	}
+
+	list := EC2Tags(tags)
+	if len(list) != len(tags) || list[0].Key != TagName {
+		t.Errorf("expected ec2 tags ordered by key got %v", list)
+	}
+}
+
+func TestNilTagPolicy(t *testing.T) {
+	var p *TagPolicy
+
+	tags := p.Tags(HostTags{Name: "d-web-x-red-1b", Color: "red", Role: "web", Environment: "dev"})
+	if _, ok := tags[TagPool]; ok {
+		t.Errorf("expected no pool tag without a pool")
+	}
+	if tags[TagName] != "d-web-x-red-1b" {
+		t.Errorf("expected the name tag got %v", tags)
+	}
+}
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// tokenBytes is the amount of randomness in a generated api token
+const tokenBytes = 32
+
+// ErrTokenNotFound is returned when no live token has the hash looked up
+var ErrTokenNotFound = errors.New("api token not found")
+
+// APIToken is a static api credential, only the sha256 of the token is stored
+type APIToken struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	TokenHash string    `json:"token_hash"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+	Revoked   bool      `json:"revoked"`
+}
+
+// APITokenConfigFun type allows function option configuration
+type APITokenConfigFun func(*APIToken)
+
+// NewAPIToken constructor for a new api token
+func NewAPIToken(opts ...func(*APIToken)) *APIToken {
+	tok := &APIToken{}
+
+	for _, opt := range opts {
+		opt(tok)
+	}
+
+	return tok
+}
+
+// WithTokenName sets the name identifying who holds the token
+func WithTokenName(name string) APITokenConfigFun {
+	return func(t *APIToken) {
+		t.Name = name
+	}
+}
+
+// WithTokenRole sets the role granted by the token
+func WithTokenRole(role string) APITokenConfigFun {
+	return func(t *APIToken) {
+		t.Role = role
+	}
+}
+
+// WithPlainToken sets the hash from a plain text token
+func WithPlainToken(token string) APITokenConfigFun {
+	return func(t *APIToken) {
+		t.TokenHash = HashToken(token)
+	}
+}
+
+// HashToken returns the hex sha256 of a plain text token
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateToken returns a new random plain text token
+func GenerateToken() (string, error) {
+	b := make([]byte, tokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("could not generate token: %s", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Get satisfies the Getter interface by looking up an unrevoked token by hash
+func (t *APIToken) Get(db *sqlx.DB) error {
+	query := `SELECT * from api_tokens where token_hash = $1 and revoked = false`
+
+	err := db.QueryRowx(query, t.TokenHash).StructScan(t)
+	if err == sql.ErrNoRows {
+		return ErrTokenNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("could not find api token: %s", err)
+	}
+
+	return nil
+}
+
+// Create inserts the token and returns the new id
+func (t *APIToken) Create(db *sqlx.DB) (string, error) {
+	insert := `INSERT INTO api_tokens (name, token_hash, role) VALUES ($1, $2, $3) RETURNING id`
+
+	if err := db.QueryRowx(insert, t.Name, t.TokenHash, t.Role).Scan(&t.ID); err != nil {
+		return "", fmt.Errorf("could not insert api token: %s", err)
+	}
+
+	return fmt.Sprintf("%d", t.ID), nil
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestAPITokenGetByHash(t *testing.T) {
+	mod, mock := initTestDB()
+	defer mod.Conn.Close()
+
+	tok := NewAPIToken(WithPlainToken("s3cret"))
+	if tok.TokenHash == "s3cret" || len(tok.TokenHash) != 64 {
+		t.Fatalf("expected a hex sha256 hash got: %s", tok.TokenHash)
+	}
+
+	rows := sqlmock.NewRows([]string{"id", "name", "token_hash", "role", "created_at", "revoked"}).
+		AddRow(1, "ci", tok.TokenHash, "allocate", time.Now(), false)
+
+	mock.ExpectQuery("SELECT .* from api_tokens where token_hash = .* and revoked = false").
+		WithArgs(tok.TokenHash).
+		WillReturnRows(rows)
+
+	errCheck(mod.Read(tok), t)
+
+	if tok.Name != "ci" || tok.Role != "allocate" {
+		t.Errorf("unexpected token got: %+v", tok)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGenerateToken(t *testing.T) {
+	a, err := GenerateToken()
+	errCheck(err, t)
+	b, err := GenerateToken()
+	errCheck(err, t)
+
+	if a == b || len(a) != 2*tokenBytes {
+		t.Errorf("expected distinct %d char tokens got: %s %s", 2*tokenBytes, a, b)
+	}
+}
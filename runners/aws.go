@@ -1,16 +1,22 @@
 package runners
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/lib/pq/hstore"
+	"github.com/mleone896/inventory/logging"
+	"github.com/mleone896/inventory/metrics"
 	"github.com/mleone896/inventory/models"
+	"github.com/mleone896/inventory/tracing"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Conn  .....
@@ -35,7 +41,7 @@ func NewConn(region, aid string) (*Conn, error) {
 	return c, nil
 }
 
-func (c *Conn) getInstances() ([]*models.Instance, error) {
+func (c *Conn) getInstances(ctx context.Context) ([]*models.Instance, error) {
 
 	params := &ec2.DescribeInstancesInput{
 		Filters: []*ec2.Filter{
@@ -46,7 +52,9 @@ func (c *Conn) getInstances() ([]*models.Instance, error) {
 		},
 	}
 
-	resp, err := c.ec2.DescribeInstances(params)
+	ctx, finish := startCall(ctx, "DescribeInstances")
+	resp, err := c.ec2.DescribeInstancesWithContext(ctx, params, traceOption(ctx))
+	finish(err)
 
 	if err != nil {
 		return nil, fmt.Errorf("could not describe instances: %s", err)
@@ -89,9 +97,11 @@ func (c *Conn) colorsFromTags(instances []models.Instance) []string {
 	return colors
 }
 
-func (c *Conn) getsubnets() ([]*models.Subnet, error) {
+func (c *Conn) getsubnets(ctx context.Context) ([]*models.Subnet, error) {
 	subs := []*models.Subnet{}
-	resp, err := c.ec2.DescribeSubnets(nil)
+	ctx, finish := startCall(ctx, "DescribeSubnets")
+	resp, err := c.ec2.DescribeSubnetsWithContext(ctx, &ec2.DescribeSubnetsInput{}, traceOption(ctx))
+	finish(err)
 
 	if err != nil {
 		return subs, fmt.Errorf("could not describe subnets: %s", err)
@@ -114,6 +124,44 @@ func (c *Conn) getsubnets() ([]*models.Subnet, error) {
 
 }
 
+// startCall counts, logs and opens a span for an ec2 call, the returned func
+// records the outcome
+func startCall(ctx context.Context, op string) (context.Context, func(error)) {
+	metrics.AWSCalls.WithLabelValues(op).Inc()
+
+	fields := logging.FromContext(ctx)
+	fields["aws_op"] = op
+	logging.Default().Debug("aws call", fields)
+
+	ctx, span := tracing.Start(ctx, "ec2."+op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			tracing.String("rpc.system", "aws-api"),
+			tracing.String("rpc.service", "EC2"),
+			tracing.String("rpc.method", op),
+		),
+	)
+
+	return ctx, func(err error) {
+		if err != nil {
+			metrics.AWSErrors.WithLabelValues(op).Inc()
+		}
+		tracing.End(span, err)
+	}
+}
+
+// traceOption tags the aws call with the request id carried by ctx so it can be
+// found in cloudtrail by user agent
+func traceOption(ctx context.Context) request.Option {
+	id := logging.RequestID(ctx)
+
+	return func(r *request.Request) {
+		if id != "" {
+			request.WithAppendUserAgent("request_id/" + id)(r)
+		}
+	}
+}
+
 func convertTags(tags []*ec2.Tag) map[string]sql.NullString {
 	data := make(map[string]sql.NullString)
 
@@ -1,10 +1,13 @@
 package runners
 
 import (
+	"context"
 	"fmt"
 	"log"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/mleone896/inventory/logging"
+	"github.com/mleone896/inventory/metrics"
 	"github.com/mleone896/inventory/models"
 )
 
@@ -75,34 +78,35 @@ func (j *Job) Exec(jf JobExecFunc) error {
 	return nil
 }
 
-// PopulateSubnets ...
-func PopulateSubnets(j *Job) error {
+// PopulateSubnets syncs the account's subnets and returns how many were synced
+func PopulateSubnets(ctx context.Context, j *Job) (int, error) {
 
 	log.Println("populateSubnets: retrieving subnets from aws")
-	subnets, err := j.aws.getsubnets()
+	subnets, err := j.aws.getsubnets(ctx)
 
 	if err != nil {
-		return fmt.Errorf("could not get subnets from AWS: %s", err)
+		return 0, fmt.Errorf("could not get subnets from AWS: %s", err)
 	}
 
 	account := models.NewAccount(j.aid)
 	log.Println("populateSubnets: syncing aws subnets")
 	if err := account.Sync(j.db, subnets); err != nil {
 		log.Println(err)
-		return err
+		return 0, err
 	}
 
 	log.Println("populateSubnets: complete")
-	return nil
+	return len(subnets), nil
 }
 
-// PopulateInstances ...
-func PopulateInstances(j *Job) error {
+// PopulateInstances syncs running instances and their colors and returns how
+// many instances were synced
+func PopulateInstances(ctx context.Context, j *Job) (int, error) {
 
 	log.Println("populateInstances: retrieving instances from aws")
-	instances, err := j.aws.getInstances()
+	instances, err := j.aws.getInstances(ctx)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	log.Println("populateInstances: syncing aws instances")
@@ -111,21 +115,50 @@ func PopulateInstances(j *Job) error {
 	err = inst.Sync(j.db, instances)
 	if err != nil {
 		log.Println(err)
-		return err
+		return 0, err
 	}
 
 	colors := models.Colors()
 
-	err = colors.Sync(j.db, colorsFromTags(instances))
+	changes, err := colors.Sync(j.db, colorsFromTags(instances))
 
 	if err != nil {
 		log.Println(err)
-		return err
+		return 0, err
+	}
+
+	auditColorChanges(ctx, j, "runner:instances", changes)
+
+	// history is secondary to the colors, a failure to record it must not stop
+	// the sync and with it the poller
+	if err := models.NewColorAssignment().Sync(j.db, j.aid, instances); err != nil {
+		log.Printf("populateInstances: could not sync color history: %s", err)
+		metrics.HistorySyncFailures.Inc()
 	}
 
 	log.Println("populateInstances: completed")
 
-	return nil
+	return len(instances), nil
+}
+
+// auditColorChanges records every color a sync claimed or released, a failed
+// write is logged rather than failing the sync
+func auditColorChanges(ctx context.Context, j *Job, actor string, changes *models.ColorChanges) {
+	record := func(action string, colors []string) {
+		for _, color := range colors {
+			ev := models.NewAuditEvent(action, actor,
+				models.WithAuditColor(color),
+				models.WithAuditRequestID(logging.RequestID(ctx)),
+				models.WithAuditDetails(map[string]string{"account_id": j.aid}),
+			)
+			if _, err := ev.Create(j.db); err != nil {
+				log.Printf("could not audit %s of %s: %s", action, color, err)
+			}
+		}
+	}
+
+	record(models.AuditColorClaim, changes.Claimed)
+	record(models.AuditColorRelease, changes.Released)
 }
 
 // colorsFromTags returns a list of colors from ec2 information
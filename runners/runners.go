@@ -1,9 +1,16 @@
 package runners
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"sync"
 	"time"
+
+	"github.com/mleone896/inventory/logging"
+	"github.com/mleone896/inventory/metrics"
+	"github.com/mleone896/inventory/models"
+	"github.com/mleone896/inventory/tracing"
 )
 
 // Runner ...
@@ -11,15 +18,26 @@ type Runner interface {
 	Exec(JobExecFunc) error
 }
 
+// SyncFunc is a task run on an interval, it returns the number of items it
+// synced. The context carries the request id the run is traced under
+type SyncFunc func(context.Context, *Job) (int, error)
+
 // RunConfigFunc ...
 type RunConfigFunc func(*Run) error
 
+// ErrAlreadyRunning is returned when a run is triggered while one is in flight
+var ErrAlreadyRunning = fmt.Errorf("job is already running")
+
 // Run ...
 type Run struct {
 	pollInterval int
 	done         chan struct{}
 	Job          *Job
 	Desc         string
+	Name         string
+	task         SyncFunc
+	mu           sync.Mutex
+	running      bool
 }
 
 // New ...
@@ -47,16 +65,33 @@ func WithDescription(s string) RunConfigFunc {
 	}
 }
 
+// WithName sets the short name the run is addressed by in the api
+func WithName(s string) RunConfigFunc {
+	return func(r *Run) error {
+		if s == "" {
+			return fmt.Errorf("run name must not be empty")
+		}
+		r.Name = s
+		return nil
+	}
+}
+
 // Loop creates a standard template for calling a function with a given interval
-func (r *Run) Loop(rf func(*Job) error) {
+func (r *Run) Loop(rf SyncFunc) {
+	r.task = rf
 	ticker := time.NewTicker(time.Duration(r.pollInterval) * time.Second)
 	go func() {
 		for {
 			select {
 			case <-ticker.C:
 				log.Printf("executing %s loop", r.Desc)
-				if err := rf(r.Job); err != nil {
-					log.Println("fatal error stopping job %v", err)
+				if !r.claim() {
+					log.Printf("skipping %s loop, a run is in flight", r.Desc)
+					continue
+				}
+				ctx := logging.WithRequestID(context.Background(), logging.NewRequestID())
+				if err := r.execute(ctx); err != nil {
+					log.Printf("fatal error stopping job %v", err)
 					r.Stop()
 				}
 			case <-r.done:
@@ -69,6 +104,111 @@ func (r *Run) Loop(rf func(*Job) error) {
 
 }
 
+// Trigger runs the task once in the background outside of the poll interval,
+// the run is traced under the request id of ctx but outlives its cancellation
+func (r *Run) Trigger(ctx context.Context) error {
+	if r.task == nil {
+		return fmt.Errorf("job %s has no task to run", r.Name)
+	}
+
+	// claimed here rather than in the goroutine so a run the ticker starts
+	// meanwhile is reported to the caller
+	if !r.claim() {
+		return ErrAlreadyRunning
+	}
+
+	id := logging.RequestID(ctx)
+	if id == "" {
+		id = logging.NewRequestID()
+	}
+	runCtx := logging.WithRequestID(context.Background(), id)
+
+	go func() {
+		log.Printf("executing triggered %s run", r.Desc)
+		if err := r.execute(runCtx); err != nil {
+			log.Printf("triggered run of %s failed: %v", r.Desc, err)
+		}
+	}()
+
+	return nil
+}
+
+// Running reports whether the task is currently executing
+func (r *Run) Running() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.running
+}
+
+// Interval returns the poll rate in seconds
+func (r *Run) Interval() int {
+	return r.pollInterval
+}
+
+// claim marks the task running, it reports false if a run is in flight
+func (r *Run) claim() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.running {
+		return false
+	}
+	r.running = true
+	return true
+}
+
+// execute runs the task once, claimed by the caller, and records the outcome
+// in job_runs
+func (r *Run) execute(ctx context.Context) error {
+	defer func() {
+		r.mu.Lock()
+		r.running = false
+		r.mu.Unlock()
+	}()
+
+	jr := models.NewJobRun(models.WithJobName(r.Name))
+	jr.StartedAt = time.Now()
+
+	ctx, span := tracing.Start(ctx, "job."+r.Name)
+	items, err := r.task(ctx, r.Job)
+	tracing.End(span, err)
+	jr.Finish(items, err)
+	observeRun(jr)
+
+	fields := logging.FromContext(ctx)
+	fields["job"] = r.Name
+	fields["items_synced"] = jr.ItemsSynced
+	fields["duration_ms"] = jr.DurationMS
+	if err != nil {
+		fields["error"] = err
+		logging.Default().Error("job run failed", fields)
+	} else {
+		logging.Default().Info("job run completed", fields)
+	}
+
+	if r.Job != nil && r.Job.db != nil {
+		if _, rerr := jr.Create(r.Job.db); rerr != nil {
+			log.Printf("could not record run of %s: %v", r.Desc, rerr)
+		}
+		if _, rerr := jr.Prune(r.Job.db, models.JobRunRetention); rerr != nil {
+			log.Printf("could not prune runs of %s: %v", r.Desc, rerr)
+		}
+	}
+
+	return err
+}
+
+// observeRun exports the outcome of a run to prometheus
+func observeRun(jr *models.JobRun) {
+	status := "success"
+	if jr.Error != "" {
+		status = "failure"
+	}
+
+	metrics.JobRuns.WithLabelValues(jr.JobName, status).Inc()
+	metrics.JobDuration.WithLabelValues(jr.JobName).Observe(float64(jr.DurationMS) / 1000)
+	metrics.JobItemsSynced.WithLabelValues(jr.JobName).Set(float64(jr.ItemsSynced))
+}
+
 // WithInterval takes the poll rate in seconds and returns a jobConfigFunc type that can
 // be passed into New
 func WithInterval(i int) RunConfigFunc {
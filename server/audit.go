@@ -0,0 +1,85 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mleone896/inventory/auth"
+	"github.com/mleone896/inventory/logging"
+	"github.com/mleone896/inventory/models"
+)
+
+// actor returns the identity of the caller for the audit log
+func actor(r *http.Request) string {
+	if id, ok := auth.FromContext(r.Context()); ok {
+		return id.String()
+	}
+	return "anonymous"
+}
+
+// audit records an event for the request, a failed write is logged rather
+// than failing a request that already succeeded
+func (ctx *APIContext) audit(r *http.Request, action, color string, details interface{}) {
+	ev := models.NewAuditEvent(action, actor(r),
+		models.WithAuditColor(color),
+		models.WithAuditRequestID(logging.RequestID(r.Context())),
+		models.WithAuditDetails(details),
+	)
+
+	if _, err := ctx.dao.WithContext(r.Context()).Create(ev); err != nil {
+		fields := logging.FromContext(r.Context())
+		fields["action"] = action
+		fields["error"] = err
+		logging.Default().Error("could not write audit event", fields)
+	}
+}
+
+// ListAudit returns audit events filtered by ?since=&actor=&color=&limit=
+func (ctx *APIContext) ListAudit(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := models.AuditFilter{
+		Actor: q.Get("actor"),
+		Color: q.Get("color"),
+	}
+
+	if since := q.Get("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			Error(w, http.StatusBadRequest, "since must be an RFC3339 timestamp", err.Error())
+			return
+		}
+		filter.Since = t
+	}
+
+	if l := q.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 {
+			Error(w, http.StatusBadRequest, "limit must be a positive integer", l)
+			return
+		}
+		filter.Limit = n
+	}
+
+	obj := models.AuditEvents(filter)
+	rows, err := ctx.dao.WithContext(r.Context()).FindAll(obj)
+
+	if err != nil {
+		Error(w, http.StatusInternalServerError, "could not find audit events", err.Error())
+		return
+	}
+
+	events, err := obj.UnpackRows(rows)
+
+	if err != nil {
+		Error(w, http.StatusInternalServerError, "could not unpack audit events", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(events); err != nil {
+		Error(w, http.StatusInternalServerError, "failed to marshal", err.Error())
+		return
+	}
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/mleone896/inventory/auth"
+	"github.com/mleone896/inventory/logging"
+)
+
+// WithAuthenticator sets how callers are identified, without one every route
+// is open
+func WithAuthenticator(a auth.Authenticator) func(*APIContext) {
+	return func(actx *APIContext) {
+		actx.authn = a
+	}
+}
+
+// require authenticates the caller and rejects it unless it holds role
+func (ctx *APIContext) require(role auth.Role, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ctx.authn == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		id, err := ctx.authn.Authenticate(r)
+		if errors.Is(err, auth.ErrUnavailable) {
+			Error(w, http.StatusServiceUnavailable, "could not check credentials", err.Error())
+			return
+		}
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="inventory"`)
+			Error(w, http.StatusUnauthorized, "authentication required", err.Error())
+			return
+		}
+
+		if rec, ok := w.(*statusRecorder); ok {
+			rec.caller = id.String()
+		}
+
+		if !id.Role.Allows(role) {
+			Error(w, http.StatusForbidden, "permission denied",
+				id.Role.String()+" role cannot access a route requiring "+role.String())
+			return
+		}
+
+		c := logging.WithCaller(auth.NewContext(r.Context(), id), id.String())
+		next.ServeHTTP(w, r.WithContext(c))
+	})
+}
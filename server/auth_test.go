@@ -0,0 +1,39 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mleone896/inventory/auth"
+)
+
+type authFunc func(*http.Request) (*auth.Identity, error)
+
+func (f authFunc) Authenticate(r *http.Request) (*auth.Identity, error) { return f(r) }
+
+func TestRequireMapsAuthErrors(t *testing.T) {
+	cases := []struct {
+		err    error
+		status int
+	}{
+		{auth.ErrInvalidCredentials, http.StatusUnauthorized},
+		{fmt.Errorf("%w: connection refused", auth.ErrUnavailable), http.StatusServiceUnavailable},
+	}
+
+	for _, c := range cases {
+		ctx := New(WithAuthenticator(authFunc(func(*http.Request) (*auth.Identity, error) {
+			return nil, c.err
+		})))
+		h := ctx.require(auth.RoleRead, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Errorf("expected the handler not to run for %v", c.err)
+		}))
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/v1/colors", nil))
+		if w.Code != c.status {
+			t.Errorf("expected %d for %v got %d", c.status, c.err, w.Code)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/mleone896/inventory/api"
+	"github.com/mleone896/inventory/db"
+	"github.com/mleone896/inventory/metrics"
+	"github.com/mleone896/inventory/models"
+)
+
+// validateBulk checks the request is one of the two accepted shapes
+func validateBulk(b *api.BulkTagsRequest) error {
+	switch {
+	case b.Count > 0 && len(b.Hosts) > 0:
+		return fmt.Errorf("send either count or hosts, not both")
+	case b.Count < 0:
+		return fmt.Errorf("count must be positive")
+	case b.Count == 0 && len(b.Hosts) == 0:
+		return fmt.Errorf("count or hosts must be given")
+	case b.Count > 0 && len(b.SubnetIDs) == 0:
+		return fmt.Errorf("subnet_ids must be given with count")
+	case b.Count > models.MaxAllocationSize || len(b.Hosts) > models.MaxAllocationSize:
+		return fmt.Errorf("at most %d hosts can be allocated at once", models.MaxAllocationSize)
+	}
+
+	return nil
+}
+
+// expandBulk turns a counted request into one request per host, taking AZs in
+// turn so the hosts are spread as evenly as the subnets allow. Unknown subnets
+// are returned as FieldErrors, anything else is a failure to read them
+func expandBulk(b *api.BulkTagsRequest, db *db.DataObj) ([]*api.TagsRequest, error) {
+	if b.Count == 0 {
+		return b.Hosts, nil
+	}
+
+	errs := FieldErrors{}
+	byAZ := make(map[string][]string)
+	for i, id := range b.SubnetIDs {
+		subnet, err := models.NewSubnet(models.WithSubnetID(id))
+		if err != nil {
+			return nil, err
+		}
+		if err := db.Read(subnet); err != nil {
+			if errors.Is(err, models.ErrSubnetNotFound) {
+				errs.add(fmt.Sprintf("subnet_ids[%d]", i), "unknown subnet %s", id)
+				continue
+			}
+			return nil, err
+		}
+		byAZ[subnet.AZ] = append(byAZ[subnet.AZ], id)
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	azs := make([]string, 0, len(byAZ))
+	for az := range byAZ {
+		azs = append(azs, az)
+	}
+	sort.Strings(azs)
+
+	treqs := make([]*api.TagsRequest, b.Count)
+	for i := range treqs {
+		subnets := byAZ[azs[i%len(azs)]]
+		treqs[i] = &api.TagsRequest{
+			Role:        b.Role,
+			Environment: b.Environment,
+			Pool:        b.Pool,
+			SubnetID:    subnets[(i/len(azs))%len(subnets)],
+		}
+	}
+
+	return treqs, nil
+}
+
+// NewTagsReqs allocates colors and names for several hosts in a single
+// transaction, all or nothing
+func (ctx *APIContext) NewTagsReqs(w http.ResponseWriter, r *http.Request) {
+	var breq api.BulkTagsRequest
+	if err := json.NewDecoder(r.Body).Decode(&breq); err != nil {
+		Error(w, http.StatusBadRequest, "could not read body, please send valid req", err.Error())
+		return
+	}
+
+	if err := validateBulk(&breq); err != nil {
+		metrics.AllocationFailures.WithLabelValues("invalid_request").Inc()
+		Error(w, http.StatusBadRequest, "could not read body, please send valid req", err.Error())
+		return
+	}
+
+	dao := ctx.dao.WithContext(r.Context())
+
+	treqs, err := expandBulk(&breq, dao)
+	var unknown FieldErrors
+	switch {
+	case errors.As(err, &unknown):
+		metrics.AllocationFailures.WithLabelValues("invalid_request").Inc()
+		ValidationError(w, unknown)
+		return
+	case err != nil:
+		Error(w, http.StatusInternalServerError, "could not find subnets", err.Error())
+		return
+	}
+
+	// counted hosts share their fields, report each problem once against the
+	// top level field rather than once per host
+	errs := FieldErrors{}
+	seen := make(map[string]bool)
+	for i, treq := range treqs {
+		field := fmt.Sprintf("hosts[%d]", i)
+		if treq == nil {
+			errs.add(field, "must be an object")
+			continue
+		}
+
+		found := validateTagsRequest(treq)
+		if breq.Count == 0 {
+			errs = append(errs, found.prefixed(field)...)
+			continue
+		}
+		for _, e := range found {
+			key := e.Field + ": " + e.Message
+			if !seen[key] {
+				seen[key] = true
+				errs = append(errs, e)
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		metrics.AllocationFailures.WithLabelValues("invalid_request").Inc()
+		ValidationError(w, errs)
+		return
+	}
+
+	dryRun, err := isDryRun(r)
+	if err != nil {
+		Error(w, http.StatusBadRequest, "dry_run must be true or false", err.Error())
+		return
+	}
+
+	start := time.Now()
+	hosts, err := ctx.generateHostTags(treqs, dao, dryRun)
+	if !dryRun {
+		metrics.AllocationDuration.Observe(time.Since(start).Seconds())
+	}
+
+	if err != nil {
+		allocationError(w, err)
+		return
+	}
+
+	if !dryRun {
+		for i, host := range hosts {
+			ctx.audit(r, models.AuditAllocate, host.Color, map[string]interface{}{
+				"request":  treqs[i],
+				"response": host,
+			})
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(api.BulkTagsResponse{Hosts: hosts}); err != nil {
+		Error(w, http.StatusInternalServerError, "could not write json response to http handler", err.Error())
+		return
+	}
+}
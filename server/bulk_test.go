@@ -0,0 +1,85 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/mleone896/inventory/api"
+)
+
+func TestBulkTagsRequestSpreadsAcrossAZs(t *testing.T) {
+	dao, mock := initTestDB()
+	defer dao.Conn.Close()
+
+	cols := []string{"id", "subnet_id", "account_id", "availability_zone", "vpc_id"}
+	for i, s := range [][]string{
+		{"subnet-a1", "us-east-1a"},
+		{"subnet-b1", "us-east-1b"},
+		{"subnet-a2", "us-east-1a"},
+	} {
+		mock.ExpectQuery("SELECT \\* from subnets").
+			WithArgs(s[0]).
+			WillReturnRows(sqlmock.NewRows(cols).AddRow(i, s[0], "181657471068", s[1], "vpc-1"))
+	}
+
+	breq := &api.BulkTagsRequest{
+		Count:       5,
+		Role:        "web",
+		Environment: "prod",
+		Pool:        "blue",
+		SubnetIDs:   []string{"subnet-a1", "subnet-b1", "subnet-a2"},
+	}
+	if err := validateBulk(breq); err != nil {
+		t.Fatal(err)
+	}
+
+	treqs, err := expandBulk(breq, dao)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"subnet-a1", "subnet-b1", "subnet-a2", "subnet-b1", "subnet-a1"}
+	for i, treq := range treqs {
+		if treq.SubnetID != want[i] {
+			t.Errorf("host %d: expected %s got: %s", i, want[i], treq.SubnetID)
+		}
+	}
+
+	if err := validateBulk(&api.BulkTagsRequest{Count: 2}); err == nil {
+		t.Errorf("expected count without subnet_ids to fail")
+	}
+}
+
+func TestNewTagsReqsSeparatesUnknownSubnetsFromFailedReads(t *testing.T) {
+	dao, mock := initTestDB()
+	defer dao.Conn.Close()
+
+	ctx := New(WithDAO(dao))
+	body := `{"count": 2, "role": "web", "environment": "prod", "pool": "blue", "subnet_ids": ["subnet-a1"]}`
+
+	mock.ExpectQuery("SELECT \\* from subnets").
+		WithArgs("subnet-a1").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	w := httptest.NewRecorder()
+	ctx.NewTagsReqs(w, httptest.NewRequest("POST", "/v1/tags/bulk", strings.NewReader(body)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected an unknown subnet to be a 400 got: %d", w.Code)
+	}
+
+	mock.ExpectQuery("SELECT \\* from subnets").
+		WithArgs("subnet-a1").
+		WillReturnError(fmt.Errorf("connection refused"))
+	w = httptest.NewRecorder()
+	ctx.NewTagsReqs(w, httptest.NewRequest("POST", "/v1/tags/bulk", strings.NewReader(body)))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected a failed read to be a 500 got: %d", w.Code)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there are unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,219 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/mleone896/inventory/api"
+	"github.com/mleone896/inventory/models"
+)
+
+// maxImportBytes bounds the size of a palette import
+const maxImportBytes = 1 << 20
+
+// AddColors adds a json list of names to the palette
+func (ctx *APIContext) AddColors(w http.ResponseWriter, r *http.Request) {
+	var req api.ColorsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		Error(w, http.StatusBadRequest, "could not read body, please send valid req", err.Error())
+		return
+	}
+
+	ctx.addColors(w, r, req.Names, "json")
+}
+
+// ImportColors adds colors from a text/plain body with one name per line or
+// a text/csv body whose first column holds the name
+func (ctx *APIContext) ImportColors(w http.ResponseWriter, r *http.Request) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	names, err := parseColorList(mediaType, http.MaxBytesReader(w, r.Body, maxImportBytes))
+	if err != nil {
+		Error(w, http.StatusBadRequest, "could not parse color list", err.Error())
+		return
+	}
+
+	ctx.addColors(w, r, names, mediaType)
+}
+
+func (ctx *APIContext) addColors(w http.ResponseWriter, r *http.Request, names []string, source string) {
+	if len(names) == 0 {
+		Error(w, http.StatusBadRequest, "no colors sent in request", "names must not be empty")
+		return
+	}
+
+	invalid := []string{}
+	for _, name := range names {
+		if err := models.ValidateColorName(name); err != nil {
+			invalid = append(invalid, err.Error())
+		}
+	}
+	if len(invalid) > 0 {
+		Error(w, http.StatusUnprocessableEntity, "invalid color names", strings.Join(invalid, "; "))
+		return
+	}
+
+	added, err := models.AddColors(ctx.dao.WithContext(r.Context()).Conn, names)
+	if err != nil {
+		Error(w, http.StatusInternalServerError, "could not add colors", err.Error())
+		return
+	}
+
+	res := api.ColorsResponse{Added: added, Skipped: []string{}}
+	wasAdded := make(map[string]bool, len(added))
+	for _, name := range added {
+		wasAdded[name] = true
+	}
+	for _, name := range names {
+		if !wasAdded[name] {
+			res.Skipped = append(res.Skipped, name)
+		}
+	}
+
+	for _, name := range added {
+		ctx.audit(r, models.AuditColorAdd, name, map[string]string{"source": source})
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		Error(w, http.StatusInternalServerError, "failed to marshal", err.Error())
+		return
+	}
+}
+
+// RetireColor removes a color that no instance holds from the palette
+func (ctx *APIContext) RetireColor(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	color, _ := models.NewColor(models.WithName(name))
+	switch err := ctx.dao.WithContext(r.Context()).Delete(color); err {
+	case nil:
+	case models.ErrColorNotFound:
+		Error(w, http.StatusNotFound, "could not retire color", err.Error())
+		return
+	case models.ErrColorInUse:
+		Error(w, http.StatusConflict, "could not retire color", err.Error())
+		return
+	default:
+		Error(w, http.StatusInternalServerError, "could not retire color", err.Error())
+		return
+	}
+
+	ctx.audit(r, models.AuditColorRetire, name, color)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ReleaseColor frees a color no instance carries, e.g. one allocated for a
+// host that was never launched
+func (ctx *APIContext) ReleaseColor(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	color, _ := models.NewColor(models.WithName(name))
+	switch err := color.Release(ctx.dao.WithContext(r.Context()).Conn); err {
+	case nil:
+	case models.ErrColorNotFound:
+		Error(w, http.StatusNotFound, "could not release color", err.Error())
+		return
+	case models.ErrColorInUse:
+		Error(w, http.StatusConflict, "could not release color", err.Error())
+		return
+	default:
+		Error(w, http.StatusInternalServerError, "could not release color", err.Error())
+		return
+	}
+
+	ctx.audit(r, models.AuditColorRelease, name, map[string]string{"source": "api"})
+
+	writeJSON(w, http.StatusOK, color)
+}
+
+// PatchColor blocks or unblocks a color
+func (ctx *APIContext) PatchColor(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	var patch api.ColorPatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		Error(w, http.StatusBadRequest, "could not read body, please send valid req", err.Error())
+		return
+	}
+
+	if patch.Blocked == nil {
+		Error(w, http.StatusBadRequest, "could not read body, please send valid req", "blocked must be set")
+		return
+	}
+
+	color, _ := models.NewColor(models.WithName(name))
+	switch err := color.SetBlocked(ctx.dao.WithContext(r.Context()).Conn, *patch.Blocked); err {
+	case nil:
+	case models.ErrColorNotFound:
+		Error(w, http.StatusNotFound, "could not update color", err.Error())
+		return
+	default:
+		Error(w, http.StatusInternalServerError, "could not update color", err.Error())
+		return
+	}
+
+	action := models.AuditColorUnblock
+	if *patch.Blocked {
+		action = models.AuditColorBlock
+	}
+	ctx.audit(r, action, name, patch)
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(color); err != nil {
+		Error(w, http.StatusInternalServerError, "failed to marshal", err.Error())
+		return
+	}
+}
+
+// parseColorList reads names from a plain text or csv body, blank lines and
+// lines starting with # are ignored as is a csv header of "name"
+func parseColorList(mediaType string, body io.Reader) ([]string, error) {
+	names := []string{}
+
+	switch mediaType {
+	case "text/csv":
+		rd := csv.NewReader(body)
+		rd.FieldsPerRecord = -1
+		rd.Comment = '#'
+		records, err := rd.ReadAll()
+		if err != nil {
+			return nil, err
+		}
+		for i, rec := range records {
+			name := strings.ToLower(strings.TrimSpace(rec[0]))
+			if name == "" || (i == 0 && name == "name") {
+				continue
+			}
+			names = append(names, name)
+		}
+	case "text/plain":
+		b, err := ioutil.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range strings.Split(string(b), "\n") {
+			name := strings.ToLower(strings.TrimSpace(line))
+			if name == "" || strings.HasPrefix(name, "#") {
+				continue
+			}
+			names = append(names, name)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported content type %s, send text/plain or text/csv", mediaType)
+	}
+
+	return names, nil
+}
@@ -0,0 +1,31 @@
+package server
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseColorList(t *testing.T) {
+	plain := "# seasonal colors\norange\n\n  Teal \nmauve\n"
+	names, err := parseColorList("text/plain", strings.NewReader(plain))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"orange", "teal", "mauve"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("expected %v got: %v", want, names)
+	}
+
+	csvBody := "name,notes\norange,warm\nteal,\"cool, calm\"\n"
+	names, err = parseColorList("text/csv", strings.NewReader(csvBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"orange", "teal"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("expected %v got: %v", want, names)
+	}
+
+	if _, err := parseColorList("application/xml", strings.NewReader("<orange/>")); err == nil {
+		t.Errorf("expected unsupported content type to fail")
+	}
+}
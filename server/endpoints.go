@@ -1,74 +1,46 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/mleone896/inventory/api"
+	"github.com/mleone896/inventory/awstags"
 	"github.com/mleone896/inventory/db"
+	"github.com/mleone896/inventory/logging"
+	"github.com/mleone896/inventory/metrics"
 	"github.com/mleone896/inventory/models"
 )
 
-// TagsRequest ...
-type TagsRequest struct {
-	Role        string `json:"primary_role"`
-	Environment string `json:"environment"`
-	SubnetID    string `json:"subnet_id"`
-	Pool        string `json:"pool,omitempty"`
-	Color       string `json:"color,omitempty"`
-	Name        string `json:"name"`
-	Owner       string `json:"owner,omitempty"`
-	err         error
-}
-
-// IsValid ...
-func (h *TagsRequest) IsValid() bool {
-	if h.Role == "" {
-		h.err = fmt.Errorf("primary_role must be valid")
-		return false
-	}
-
-	if h.Environment == "" {
-		h.err = fmt.Errorf("environment must be valid")
-		return false
-	}
-
-	if h.SubnetID == "" {
-		h.err = fmt.Errorf("subnet_id must be valid")
-		return false
-	}
-
-	if h.Pool == "" {
-		h.err = fmt.Errorf("pool must be valid")
-		return false
-	}
-
-	return true
-}
-
-// APIError struct represents a json return erorr type
-type APIError struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
-	Detail  string `json:"detail"`
-}
+// errNameConflict is returned when a requested name does not match the name
+// the request would be given
+var errNameConflict = errors.New("requested name does not match the request")
 
 // Error ...
 func Error(w http.ResponseWriter, status int, reason, detail string) {
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	w.WriteHeader(status)
-	errorJSON, _ := json.Marshal(APIError{
+	writeAPIError(w, api.APIError{
 		Code:    status,
 		Message: reason,
 		Detail:  detail})
+}
+
+func writeAPIError(w http.ResponseWriter, apiErr api.APIError) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(apiErr.Code)
+	errorJSON, _ := json.Marshal(apiErr)
 
 	_, err := w.Write(errorJSON)
 
 	if err != nil {
-		log.Printf("could not write api error  %s", reason)
+		log.Printf("could not write api error  %s", apiErr.Message)
 	}
 
 }
@@ -106,30 +78,52 @@ func (ctx *APIContext) ListHostAttrsByColor(w http.ResponseWriter, r *http.Reque
 
 // NewTagsReq ...
 func (ctx *APIContext) NewTagsReq(w http.ResponseWriter, r *http.Request) {
-	var hreq *TagsRequest
+	var hreq *api.TagsRequest
 	// decode the req
 	if err := json.NewDecoder(r.Body).Decode(&hreq); err != nil {
 		Error(w, http.StatusBadRequest, "could not read body, please send valid req", err.Error())
 		return
 	}
 
-	// make sure all fields have values
-	if !hreq.IsValid() {
-		Error(w, http.StatusBadRequest, "could not read body, please send valid req", hreq.err.Error())
+	if hreq == nil {
+		Error(w, http.StatusBadRequest, "could not read body, please send valid req", "body must be a json object")
+		return
+	}
+
+	// make sure all fields have well formed, allowed values
+	if errs := validateTagsRequest(hreq); len(errs) > 0 {
+		metrics.AllocationFailures.WithLabelValues("invalid_request").Inc()
+		ValidationError(w, errs)
+		return
+	}
+
+	dryRun, err := isDryRun(r)
+	if err != nil {
+		Error(w, http.StatusBadRequest, "dry_run must be true or false", err.Error())
 		return
 	}
 
-	response, err := generateNewHostTags(hreq, ctx.dao)
+	start := time.Now()
+	response, err := ctx.generateNewHostTags(hreq, ctx.dao.WithContext(r.Context()), dryRun)
+	if !dryRun {
+		metrics.AllocationDuration.Observe(time.Since(start).Seconds())
+	}
 
 	if err != nil {
-		Error(w, http.StatusInternalServerError, "could not generate correct host tags", hreq.err.Error())
+		allocationError(w, err)
 		return
+	}
 
+	if !dryRun {
+		ctx.audit(r, models.AuditAllocate, response.Color, map[string]interface{}{
+			"request":  hreq,
+			"response": response,
+		})
 	}
 
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		Error(w, http.StatusInternalServerError, "could not write json response to http handler", hreq.err.Error())
+		Error(w, http.StatusInternalServerError, "could not write json response to http handler", err.Error())
 		return
 	}
 
@@ -137,24 +131,87 @@ func (ctx *APIContext) NewTagsReq(w http.ResponseWriter, r *http.Request) {
 
 }
 
-// ListColors returns all the available colors not in use
+// isDryRun reads ?dry_run=, a dry run previews an allocation without
+// keeping it
+func isDryRun(r *http.Request) (bool, error) {
+	v := r.URL.Query().Get("dry_run")
+	if v == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(v)
+}
+
+// allocationError writes the response for an allocation that failed
+func allocationError(w http.ResponseWriter, err error) {
+	var invalid FieldErrors
+	if errors.As(err, &invalid) {
+		metrics.AllocationFailures.WithLabelValues("invalid_request").Inc()
+		ValidationError(w, invalid)
+		return
+	}
+
+	if errors.Is(err, models.ErrColorNotFound) || errors.Is(err, models.ErrColorUnavailable) || errors.Is(err, errNameConflict) {
+		metrics.AllocationFailures.WithLabelValues("conflict").Inc()
+		Error(w, http.StatusConflict, "requested color is not available", err.Error())
+		return
+	}
+
+	var exhausted *models.ExhaustedError
+	if errors.As(err, &exhausted) {
+		metrics.AllocationFailures.WithLabelValues("exhausted").Inc()
+
+		// colors still cooling down or held by concurrent allocations will
+		// free up on their own, otherwise the palette needs colors added or
+		// unblocked
+		status := http.StatusConflict
+		if exhausted.Temporary() {
+			status = http.StatusServiceUnavailable
+		}
+		Error(w, status, "palette exhausted", exhausted.Error())
+		return
+	}
+
+	metrics.AllocationFailures.WithLabelValues("internal").Inc()
+	Error(w, http.StatusInternalServerError, "could not generate correct host tags", err.Error())
+}
+
+// ListColors returns a page of the colors in ?state=, free ones by default,
+// and their holders. What is cooling down depends on the cooldown of
+// ?environment=
 func (ctx *APIContext) ListColors(w http.ResponseWriter, r *http.Request) {
+	q, err := pageQuery(r)
+	if err != nil {
+		Error(w, http.StatusBadRequest, "invalid page query", err.Error())
+		return
+	}
+
+	scope := q.Filters["environment"]
+	if scope == "" {
+		scope = models.DefaultScope
+	}
+	delete(q.Filters, "environment")
+
+	obj, err := models.ColorList(q, ctx.cooldowns.For(scope))
+	if err != nil {
+		listError(w, "could not find colors", err)
+		return
+	}
 
-	obj := models.Colors()
-	rows, err := ctx.dao.FindAll(obj)
+	rows, err := ctx.dao.WithContext(r.Context()).FindAll(obj)
 
 	if err != nil {
-		Error(w, http.StatusInternalServerError, "could not find colors", err.Error())
+		listError(w, "could not find colors", err)
 		return
 	}
 
-	colors, err := obj.UnpackRows(rows)
+	colors, next, err := obj.UnpackRows(rows)
 
 	if err != nil {
 		Error(w, http.StatusInternalServerError, "could not unpack colors", err.Error())
 		return
 	}
 
+	setNextPage(w, r, next)
 	if err := json.NewEncoder(w).Encode(colors); err != nil {
 		Error(w, http.StatusInternalServerError, "failed to marshal", err.Error())
 		return
@@ -163,48 +220,259 @@ func (ctx *APIContext) ListColors(w http.ResponseWriter, r *http.Request) {
 
 }
 
-func generateNewHostTags(treq *TagsRequest, db *db.DataObj) (*TagsRequest, error) {
+// SummarizeColors returns how many colors are free, in use, cooling down and
+// blocked
+func (ctx *APIContext) SummarizeColors(w http.ResponseWriter, r *http.Request) {
+	scope := r.URL.Query().Get("environment")
+	if scope == "" {
+		scope = models.DefaultScope
+	}
+	cooldown := ctx.cooldowns.For(scope)
+
+	color, _ := models.NewColor(models.WithCooldown(cooldown))
+	counts, err := color.Counts(ctx.dao.WithContext(r.Context()).Conn)
+	if err != nil {
+		Error(w, http.StatusInternalServerError, "could not count colors", err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &api.ColorSummary{
+		Scope:    scope,
+		Cooldown: cooldown.String(),
+		Total:    counts.Free + counts.InUse + counts.CoolingDown + counts.Blocked,
+		Counts:   *counts,
+	})
+}
 
-	res := new(TagsRequest)
-	// get the subnet from the id sent in payload
+// ColorHistory returns every instance and allocation that has held a color
+func (ctx *APIContext) ColorHistory(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
 
-	subnet, err := models.NewSubnet(models.WithSubnetID(treq.SubnetID))
+	obj := models.NewColorAssignment(models.WithAssignedColor(name))
+	rows, err := ctx.dao.WithContext(r.Context()).FindAll(obj)
 
 	if err != nil {
-		return nil, err
+		Error(w, http.StatusInternalServerError, "could not find color history", err.Error())
+		return
+	}
+
+	history, err := obj.UnpackRows(rows)
+
+	if err != nil {
+		Error(w, http.StatusInternalServerError, "could not unpack color history", err.Error())
+		return
 	}
 
-	// get the subnet from the db and populate the object
-	if err := db.Read(subnet); err != nil {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(history); err != nil {
+		Error(w, http.StatusInternalServerError, "failed to marshal", err.Error())
+		return
+	}
+}
+
+func (ctx *APIContext) generateNewHostTags(treq *api.TagsRequest, db *db.DataObj, dryRun bool) (*api.TagsResponse, error) {
+	res, err := ctx.generateHostTags([]*api.TagsRequest{treq}, db, dryRun)
+	if err != nil {
 		return nil, err
 	}
+	return res[0], nil
+}
 
-	color, err := models.NewColor(models.WithDefault())
+// generateHostTags allocates a color and name for every request in a single
+// transaction, if one can't be served none are. A dry run previews the names
+// with the colors that would be picked without keeping them
+func (ctx *APIContext) generateHostTags(treqs []*api.TagsRequest, db *db.DataObj, dryRun bool) ([]*api.TagsResponse, error) {
+	subnets := make(map[string]*models.Subnet)
+	colors := make([]*models.Color, len(treqs))
+	owners := make([]string, len(treqs))
+	alloc := models.NewAllocation(models.WithDryRun(dryRun))
 
-	// get a random unused color from db and populate color object
-	if err := db.Read(color); err != nil {
+	reg, err := ctx.registry.get(db.Conn)
+	if err != nil {
 		return nil, err
 	}
 
-	// this is no bueno
-	nameTag := formatHostName(
-		treq.Environment,
-		treq.Role,
-		treq.Pool,
-		color.Name,
-		factorAvailabiltyZone(subnet.AZ))
+	errs := FieldErrors{}
+	for i, treq := range treqs {
+		found := registryErrors(reg, treq)
+		if len(treqs) > 1 {
+			found = found.prefixed(fmt.Sprintf("hosts[%d]", i))
+		}
+		errs = append(errs, found...)
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	for i, treq := range treqs {
+		// get the subnet from the id sent in payload
+		subnet, ok := subnets[treq.SubnetID]
+		if !ok {
+			var err error
+			subnet, err = models.NewSubnet(models.WithSubnetID(treq.SubnetID))
+			if err != nil {
+				return nil, err
+			}
+
+			// get the subnet from the db and populate the object
+			if err := db.Read(subnet); err != nil {
+				return nil, err
+			}
+			subnets[treq.SubnetID] = subnet
+		}
+
+		// a requested name carries the color it asks for and must be the name
+		// the request would be given
+		requested := treq.Color
+		if treq.Name != "" {
+			if requested == "" {
+				requested = colorFromHostName(treq.Name)
+			}
+			want, _, err := ctx.hostName(reg, treq.Environment, treq.Role, treq.Pool, requested, factorAvailabiltyZone(subnet.AZ))
+			if err != nil {
+				return nil, hostErrors(err, i, len(treqs))
+			}
+			if want != treq.Name {
+				return nil, fmt.Errorf("%w: expected %s got %s", errNameConflict, want, treq.Name)
+			}
+		}
+
+		// the environment is the scope the color's cooldown is looked up by
+		color, err := models.NewColor(
+			models.WithName(requested),
+			models.WithReplacing(treq.Replaces),
+			models.WithCooldown(ctx.cooldowns.For(treq.Environment)),
+			models.WithPalettePolicy(ctx.palette),
+			models.WithSelector(ctx.selector),
+			models.WithPeers(treq.Role, treq.Pool),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		owner, err := ctx.resolveOwner(db, reg, treq, subnet)
+		if err != nil {
+			return nil, err
+		}
+
+		// the color's history stays open until an instance is seen carrying it
+		colors[i] = color
+		owners[i] = owner
+		alloc.Add(color, subnet.AccountID, owner)
+	}
+
+	// claim the requested colors or get random unused ones from db and
+	// populate the color objects
+	if err := db.Read(alloc); err != nil {
+		return nil, err
+	}
 
-	res.Name = nameTag
-	res.Color = color.Name
-	res.Owner = "TBD"
-	res.Role = treq.Role
-	res.SubnetID = treq.SubnetID
-	res.Pool = treq.Pool
-	res.Environment = treq.Environment
+	res := make([]*api.TagsResponse, len(treqs))
+	for i, treq := range treqs {
+		color := colors[i]
+		subnet := subnets[treq.SubnetID]
+
+		if treq.Color == "" && treq.Name == "" && !dryRun {
+			ctx.checkPalette(db.Context(), treq.Environment, color)
+		}
+
+		// this is no bueno
+		nameTag, nameViolations, err := ctx.hostName(
+			reg,
+			treq.Environment,
+			treq.Role,
+			treq.Pool,
+			color.Name,
+			factorAvailabiltyZone(subnet.AZ))
+		if err != nil {
+			return nil, hostErrors(err, i, len(treqs))
+		}
+
+		tags, tagViolations, err := ctx.limits.Tags(ctx.tags.Tags(models.HostTags{
+			Name:        nameTag,
+			Color:       color.Name,
+			Owner:       owners[i],
+			Environment: treq.Environment,
+			Role:        treq.Role,
+			Pool:        treq.Pool,
+			AccountID:   subnet.AccountID,
+		}), models.TagName, models.TagColor, models.TagOwner, models.TagRole, models.TagEnvironment, models.TagPool)
+		if err != nil {
+			return nil, hostErrors(err, i, len(treqs))
+		}
+
+		violations := append(append(awstags.Violations{}, nameViolations...), tagViolations...)
+		if len(violations) > 0 {
+			fields := logging.FromContext(db.Context())
+			fields["name"] = nameTag
+			fields["violations"] = violations
+			logging.Default().Warn("truncated host name or tags breaking aws limits", fields)
+		}
+
+		res[i] = &api.TagsResponse{
+			TagsRequest: api.TagsRequest{
+				Name:        nameTag,
+				Color:       color.Name,
+				Owner:       owners[i],
+				Role:        treq.Role,
+				SubnetID:    treq.SubnetID,
+				Pool:        treq.Pool,
+				Environment: treq.Environment,
+				Replaces:    treq.Replaces,
+			},
+			Tags:       tags,
+			EC2Tags:    models.EC2Tags(tags),
+			Violations: violations,
+		}
+	}
 
 	return res, nil
 }
 
+// resolveOwner picks the owner of a host by the configured precedence
+func (ctx *APIContext) resolveOwner(db *db.DataObj, reg *models.Registry, treq *api.TagsRequest, subnet *models.Subnet) (string, error) {
+	owner, source, err := ctx.owners.Resolve(models.OwnerInputs{
+		Requested:   treq.Owner,
+		Registry:    reg,
+		Environment: treq.Environment,
+		Role:        treq.Role,
+		Pool:        treq.Pool,
+		Subnet:      subnet,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	fields := logging.FromContext(db.Context())
+	fields["owner"] = owner
+	fields["owner_source"] = source
+	logging.Default().Debug("resolved host owner", fields)
+
+	return owner, nil
+}
+
+// checkPalette warns when an allocation fell back or left the palette of
+// scope below its low water mark
+func (ctx *APIContext) checkPalette(c context.Context, scope string, color *models.Color) {
+	fields := logging.FromContext(c)
+	fields["scope"] = scope
+	fields["color"] = color.Name
+
+	if color.FellBack() {
+		metrics.PaletteFallbacks.WithLabelValues(scope, string(ctx.palette.Fallback)).Inc()
+		fields["fallback"] = ctx.palette.Fallback
+		logging.Default().Warn("palette exhausted, allocated a fallback color", fields)
+		return
+	}
+
+	if ctx.palette.Low(color.Remaining()) {
+		metrics.PaletteLow.WithLabelValues(scope).Inc()
+		fields["remaining"] = color.Remaining()
+		fields["low_water"] = ctx.palette.LowWater
+		logging.Default().Warn("palette is running low on free colors", fields)
+	}
+}
+
 // gets the identifier out of an aws az
 func factorAvailabiltyZone(az string) string {
 	// NOTE(mlcrsi): this is prone to error if AvailabilityZone does not meet
@@ -215,21 +483,85 @@ func factorAvailabiltyZone(az string) string {
 	return azIdentifier
 }
 
-// essentially takes a req + subnet identifier and returns the Name tag
-func formatHostName(env, role, pool, color, azIdentifier string) string {
-	// Determine the hostname
-	return fmt.Sprintf(
-		"%s-%s-%s-%s-%s",
-		string(env[0]),
-		role,
-		string(pool[0]),
+// essentially takes a req + subnet identifier and returns the parts of the
+// Name tag, the environment, role and pool are written as their registered
+// short codes
+func hostNameParts(reg *models.Registry, env, role, pool, color, azIdentifier string) []string {
+	return []string{
+		reg.Code(models.Environments, env),
+		reg.Code(models.Roles, role),
+		reg.Code(models.Pools, pool),
 		color,
 		azIdentifier,
-	)
+	}
+}
+
+// hostNameRole is the part of a host name shortened when it breaks the dns
+// limits, keeping the color and AZ ending the name
+const hostNameRole = 1
+
+// hostName formats the name of a host and checks it against the dns limits
+func (ctx *APIContext) hostName(reg *models.Registry, env, role, pool, color, azIdentifier string) (string, awstags.Violations, error) {
+	return ctx.limits.Label(hostNameParts(reg, env, role, pool, color, azIdentifier), hostNameRole)
+}
+
+// hostErrors turns the limits broken by the i-th of n hosts into field errors
+func hostErrors(err error, i, n int) error {
+	var v awstags.Violations
+	if !errors.As(err, &v) {
+		return err
+	}
+
+	errs := violationErrors(v)
+	if n > 1 {
+		errs = errs.prefixed(fmt.Sprintf("hosts[%d]", i))
+	}
+	return errs
+}
+
+// registryErrors checks the environment, role and pool are registered and
+// allowed together
+func registryErrors(reg *models.Registry, treq *api.TagsRequest) FieldErrors {
+	errs := FieldErrors{}
+
+	fields := []struct {
+		field string
+		kind  models.RegistryKind
+		value string
+	}{
+		{"environment", models.Environments, treq.Environment},
+		{"primary_role", models.Roles, treq.Role},
+		{"pool", models.Pools, treq.Pool},
+	}
+	for _, f := range fields {
+		if _, ok := reg.Lookup(f.kind, f.value); !ok {
+			errs = append(errs, api.FieldError{
+				Field:   f.field,
+				Message: fmt.Sprintf("%q is not a registered %s", f.value, strings.TrimSuffix(string(f.kind), "s")),
+				Allowed: reg.Names(f.kind),
+			})
+		}
+	}
+
+	combo := models.Combination{Environment: treq.Environment, Role: treq.Role, Pool: treq.Pool}
+	if len(errs) == 0 && !reg.Allows(combo) {
+		errs.add("primary_role", "%s is not allowed in environment %s and pool %s", treq.Role, treq.Environment, treq.Pool)
+	}
+
+	return errs
+}
+
+// colorFromHostName returns the color part of a name made by hostNameParts
+func colorFromHostName(name string) string {
+	parts := strings.Split(name, "-")
+	if len(parts) < 5 {
+		return ""
+	}
+	return parts[len(parts)-2]
 }
 
-func convertInstanceToTagsReq(i *models.Instance) *TagsRequest {
-	tr := &TagsRequest{}
+func convertInstanceToTagsReq(i *models.Instance) *api.TagsRequest {
+	tr := &api.TagsRequest{}
 	tr.Role = i.Tags.Map["role"].String
 	tr.Color = i.Tags.Map["color"].String
 	tr.SubnetID = i.SubnetID
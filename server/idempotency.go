@@ -0,0 +1,143 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mleone896/inventory/api"
+	"github.com/mleone896/inventory/logging"
+	"github.com/mleone896/inventory/models"
+)
+
+// idempotentReplayHeader marks a response replayed from an earlier request
+const idempotentReplayHeader = "Idempotent-Replayed"
+
+// maxIdempotentBody bounds the payloads read to be hashed
+const maxIdempotentBody = 1 << 20
+
+// inFlightRetryAfter is the Retry-After, in seconds, of a request whose key
+// is still being served
+const inFlightRetryAfter = "1"
+
+// WithIdempotencyWindow sets how long responses to keyed requests are replayed
+func WithIdempotencyWindow(d time.Duration) func(*APIContext) {
+	return func(actx *APIContext) {
+		actx.idempotencyWindow = d
+	}
+}
+
+// responseCapture keeps a copy of what a handler writes
+type responseCapture struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+// WriteHeader ...
+func (c *responseCapture) WriteHeader(code int) {
+	c.status = code
+	c.ResponseWriter.WriteHeader(code)
+}
+
+// Write ...
+func (c *responseCapture) Write(b []byte) (int, error) {
+	c.body.Write(b)
+	return c.ResponseWriter.Write(b)
+}
+
+// idempotent replays the stored response of a request repeated with the same
+// Idempotency-Key and payload, keys are scoped to the caller and route. A key
+// reused with another payload is rejected with 422
+func (ctx *APIContext) idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(api.IdempotencyKeyHeader)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if len(key) > models.MaxIdempotencyKeyLen {
+			Error(w, http.StatusBadRequest, "invalid idempotency key",
+				api.IdempotencyKeyHeader+" must be at most "+strconv.Itoa(models.MaxIdempotencyKeyLen)+" characters")
+			return
+		}
+
+		// one byte past the limit tells a body that is too large from one that
+		// fits exactly, a truncated payload must never be hashed or handled
+		payload, err := ioutil.ReadAll(io.LimitReader(r.Body, maxIdempotentBody+1))
+		if err != nil {
+			Error(w, http.StatusBadRequest, "could not read body, please send valid req", err.Error())
+			return
+		}
+		if len(payload) > maxIdempotentBody {
+			Error(w, http.StatusRequestEntityTooLarge, "request body too large",
+				"bodies sent with an "+api.IdempotencyKeyHeader+" must be at most "+strconv.Itoa(maxIdempotentBody)+" bytes")
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(payload))
+
+		dao := ctx.dao.WithContext(r.Context())
+		// the query is part of the request, a dry run must not replay as a
+		// real allocation
+		scope := actor(r) + " " + r.Method + " " + routeTemplate(r)
+		if r.URL.RawQuery != "" {
+			scope += "?" + r.URL.RawQuery
+		}
+		stored := models.NewIdempotencyKey(key, scope, payload)
+
+		reserved, err := stored.Reserve(dao.Conn, ctx.idempotencyWindow)
+		if err != nil {
+			Error(w, http.StatusInternalServerError, "could not check idempotency key", err.Error())
+			return
+		}
+
+		if !reserved {
+			switch {
+			case !stored.Matches(payload):
+				Error(w, http.StatusUnprocessableEntity, "idempotency key reused with a different payload", key)
+			case stored.InFlight():
+				w.Header().Set("Retry-After", inFlightRetryAfter)
+				Error(w, http.StatusConflict, "a request with this idempotency key is in progress", key)
+			default:
+				w.Header().Set("Content-Type", "application/json; charset=utf-8")
+				w.Header().Set(idempotentReplayHeader, "true")
+				w.WriteHeader(stored.Status)
+				w.Write(stored.Response)
+			}
+			return
+		}
+
+		capture := &responseCapture{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			// a panicking handler has no response to replay, the key is
+			// released before the panic carries on up
+			rec := recover()
+
+			var err error
+			if rec != nil || capture.status >= http.StatusInternalServerError {
+				// server errors are not replayed so the client's retry gets
+				// another go
+				err = stored.Release(dao.Conn)
+			} else {
+				err = stored.Complete(dao.Conn, capture.status, capture.body.Bytes())
+			}
+
+			if err != nil {
+				fields := logging.FromContext(r.Context())
+				fields["idempotency_key"] = key
+				fields["error"] = err
+				logging.Default().Error("could not store idempotent response", fields)
+			}
+
+			if rec != nil {
+				panic(rec)
+			}
+		}()
+
+		next.ServeHTTP(capture, r)
+	})
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/mleone896/inventory/api"
+	"github.com/mleone896/inventory/models"
+)
+
+func TestIdempotentReplaysAndRejectsMismatch(t *testing.T) {
+	dao, mock := initTestDB()
+	defer dao.Conn.Close()
+	ctx := New(WithDAO(dao))
+
+	calls := 0
+	h := ctx.idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"color":"orange"}`))
+	}))
+
+	body := `{"primary_role":"web"}`
+	stored := models.NewIdempotencyKey("k1", "anonymous POST unmatched", []byte(body))
+	cols := []string{"key", "scope", "request_hash", "status", "response", "created_at"}
+
+	// first call reserves the key and stores the response
+	mock.ExpectQuery("INSERT INTO idempotency_keys").
+		WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(stored.CreatedAt))
+	mock.ExpectExec("UPDATE idempotency_keys SET status").
+		WithArgs(http.StatusOK, []byte(`{"color":"orange"}`), stored.Scope, "k1", stored.CreatedAt, stored.RequestHash).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// the retry finds it and replays
+	mock.ExpectQuery("INSERT INTO idempotency_keys").
+		WillReturnRows(sqlmock.NewRows([]string{"created_at"}))
+	mock.ExpectQuery("SELECT \\* FROM idempotency_keys").
+		WillReturnRows(sqlmock.NewRows(cols).
+			AddRow("k1", stored.Scope, stored.RequestHash, 200, []byte(`{"color":"orange"}`), stored.CreatedAt))
+
+	// another payload under the same key is refused
+	mock.ExpectQuery("INSERT INTO idempotency_keys").
+		WillReturnRows(sqlmock.NewRows([]string{"created_at"}))
+	mock.ExpectQuery("SELECT \\* FROM idempotency_keys").
+		WillReturnRows(sqlmock.NewRows(cols).
+			AddRow("k1", stored.Scope, stored.RequestHash, 200, []byte(`{"color":"orange"}`), stored.CreatedAt))
+
+	// a retry while the first call is still served is asked to come back
+	mock.ExpectQuery("INSERT INTO idempotency_keys").
+		WillReturnRows(sqlmock.NewRows([]string{"created_at"}))
+	mock.ExpectQuery("SELECT \\* FROM idempotency_keys").
+		WillReturnRows(sqlmock.NewRows(cols).
+			AddRow("k1", stored.Scope, stored.RequestHash, 0, nil, stored.CreatedAt))
+
+	send := func(payload string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/v1/new_host", strings.NewReader(payload))
+		r.Header.Set(api.IdempotencyKeyHeader, "k1")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := send(body); w.Code != http.StatusOK {
+		t.Fatalf("expected first call to succeed got: %d", w.Code)
+	}
+
+	w := send(body)
+	if w.Code != http.StatusOK || w.Body.String() != `{"color":"orange"}` || w.Header().Get(idempotentReplayHeader) != "true" {
+		t.Errorf("expected replayed response got: %d %s", w.Code, w.Body.String())
+	}
+
+	if w := send(`{"primary_role":"db"}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected mismatched payload to be rejected got: %d", w.Code)
+	}
+
+	if w := send(body); w.Code != http.StatusConflict || w.Header().Get("Retry-After") == "" {
+		t.Errorf("expected an in flight key to conflict with a Retry-After got: %d %v", w.Code, w.Header())
+	}
+
+	if calls != 1 {
+		t.Errorf("expected the handler to run once got: %d", calls)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there are unfulfilled expectations: %s", err)
+	}
+}
+
+func TestIdempotentReleasesKeyOnPanic(t *testing.T) {
+	dao, mock := initTestDB()
+	defer dao.Conn.Close()
+	ctx := New(WithDAO(dao))
+
+	h := ctx.idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("allocation blew up")
+	}))
+
+	mock.ExpectQuery("INSERT INTO idempotency_keys").
+		WithArgs("k1", sqlmock.AnyArg(), sqlmock.AnyArg(), models.DefaultIdempotencyWindow.Seconds(), models.IdempotencyLease.Seconds()).
+		WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(time.Now()))
+	mock.ExpectExec("DELETE FROM idempotency_keys").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	r := httptest.NewRequest("POST", "/v1/new_host", strings.NewReader(`{}`))
+	r.Header.Set(api.IdempotencyKeyHeader, "k1")
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("expected the panic to carry on")
+			}
+		}()
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}()
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there are unfulfilled expectations: %s", err)
+	}
+}
+
+func TestIdempotentRejectsLargeBodies(t *testing.T) {
+	dao, mock := initTestDB()
+	defer dao.Conn.Close()
+	ctx := New(WithDAO(dao))
+
+	h := ctx.idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("expected the handler not to run")
+	}))
+
+	r := httptest.NewRequest("POST", "/v1/new_host", strings.NewReader(strings.Repeat("a", maxIdempotentBody+1)))
+	r.Header.Set(api.IdempotencyKeyHeader, "k1")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413 got: %d", w.Code)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there are unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/mleone896/inventory/api"
+	"github.com/mleone896/inventory/models"
+	"github.com/mleone896/inventory/runners"
+)
+
+// ListJobs returns every registered runner with its last recorded run
+func (ctx *APIContext) ListJobs(w http.ResponseWriter, r *http.Request) {
+	names := make([]string, 0, len(ctx.runs))
+	for name := range ctx.runs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	dao := ctx.dao.WithContext(r.Context())
+	statuses := make([]api.JobStatus, 0, len(names))
+	for _, name := range names {
+		run := ctx.runs[name]
+		status := api.JobStatus{
+			Name:        run.Name,
+			Description: run.Desc,
+			Interval:    run.Interval(),
+			Running:     run.Running(),
+		}
+
+		last := models.NewJobRun(models.WithJobName(name))
+		// a job that has never run has no rows, that is not an error
+		err := dao.Read(last)
+		switch {
+		case err == nil:
+			status.LastRun = jobRun(last)
+		case !errors.Is(err, models.ErrNoJobRuns):
+			Error(w, http.StatusInternalServerError, "could not find last run of "+name, err.Error())
+			return
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(statuses); err != nil {
+		Error(w, http.StatusInternalServerError, "failed to marshal", err.Error())
+		return
+	}
+}
+
+// jobRun is the wire form of a recorded run
+func jobRun(r *models.JobRun) *api.JobRun {
+	return &api.JobRun{
+		ID:          r.ID,
+		JobName:     r.JobName,
+		StartedAt:   r.StartedAt,
+		FinishedAt:  r.FinishedAt,
+		DurationMS:  r.DurationMS,
+		ItemsSynced: r.ItemsSynced,
+		Error:       r.Error,
+	}
+}
+
+// ListJobRuns returns the run history of a single job, newest first
+func (ctx *APIContext) ListJobRuns(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	if _, ok := ctx.runs[name]; !ok {
+		Error(w, http.StatusNotFound, "unknown job", name)
+		return
+	}
+
+	limit := models.DefaultJobRunLimit
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 {
+			Error(w, http.StatusBadRequest, "limit must be a positive integer", l)
+			return
+		}
+		limit = n
+	}
+
+	obj := models.NewJobRun(models.WithJobName(name), models.WithRunLimit(limit))
+	rows, err := ctx.dao.WithContext(r.Context()).FindAll(obj)
+
+	if err != nil {
+		Error(w, http.StatusInternalServerError, "could not find job runs", err.Error())
+		return
+	}
+
+	runs, err := obj.UnpackRows(rows)
+
+	if err != nil {
+		Error(w, http.StatusInternalServerError, "could not unpack job runs", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(runs); err != nil {
+		Error(w, http.StatusInternalServerError, "failed to marshal", err.Error())
+		return
+	}
+}
+
+// TriggerJob starts an on-demand run of a job
+func (ctx *APIContext) TriggerJob(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	run, ok := ctx.runs[name]
+	if !ok {
+		Error(w, http.StatusNotFound, "unknown job", name)
+		return
+	}
+
+	if err := run.Trigger(r.Context()); err != nil {
+		status := http.StatusInternalServerError
+		if err == runners.ErrAlreadyRunning {
+			status = http.StatusConflict
+		}
+		Error(w, status, "could not trigger job", err.Error())
+		return
+	}
+
+	ctx.audit(r, models.AuditJobTrigger, "", map[string]string{"job": name})
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(map[string]string{"job": name, "status": "triggered"}); err != nil {
+		Error(w, http.StatusInternalServerError, "failed to marshal", err.Error())
+		return
+	}
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/mleone896/inventory/runners"
+)
+
+func TestListJobsFailsWhenRunsCantBeRead(t *testing.T) {
+	dao, mock := initTestDB()
+	defer dao.Conn.Close()
+
+	run, err := runners.New(runners.WithName("instances"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := New(WithDAO(dao), WithRunners(run))
+
+	mock.ExpectQuery("SELECT .* from job_runs").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	w := httptest.NewRecorder()
+	ctx.ListJobs(w, httptest.NewRequest("GET", "/v1/jobs", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected a job without runs to be listed got: %d", w.Code)
+	}
+
+	mock.ExpectQuery("SELECT .* from job_runs").
+		WillReturnError(fmt.Errorf("connection refused"))
+	w = httptest.NewRecorder()
+	ctx.ListJobs(w, httptest.NewRequest("GET", "/v1/jobs", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected a failed read to be a 500 got: %d", w.Code)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there are unfulfilled expectations: %s", err)
+	}
+}
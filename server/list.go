@@ -0,0 +1,161 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/lib/pq/hstore"
+	"github.com/mleone896/inventory/api"
+	"github.com/mleone896/inventory/models"
+)
+
+// tagMap drops the null tags of h
+func tagMap(h hstore.Hstore) map[string]string {
+	tags := make(map[string]string, len(h.Map))
+	for k, v := range h.Map {
+		if v.Valid {
+			tags[k] = v.String
+		}
+	}
+	return tags
+}
+
+// pageQuery reads ?limit=&cursor=&sort=, every other parameter is a filter
+func pageQuery(r *http.Request) (models.PageQuery, error) {
+	q := models.PageQuery{Filters: make(map[string]string)}
+
+	for key, values := range r.URL.Query() {
+		switch key {
+		case "limit":
+			n, err := strconv.Atoi(values[0])
+			if err != nil || n < 1 {
+				return q, errors.New("limit must be a positive integer")
+			}
+			q.Limit = n
+		case "cursor":
+			q.Cursor = values[0]
+		case "sort":
+			q.Sort = values[0]
+		default:
+			q.Filters[key] = values[0]
+		}
+	}
+
+	return q, nil
+}
+
+// setNextPage points the client at the page after this one, in a Link header
+// keeping the request's sort and filters and in NextCursorHeader
+func setNextPage(w http.ResponseWriter, r *http.Request, next string) {
+	if next == "" {
+		return
+	}
+
+	q := r.URL.Query()
+	q.Set("cursor", next)
+	u := url.URL{Path: r.URL.Path, RawQuery: q.Encode()}
+
+	w.Header().Set(api.NextCursorHeader, next)
+	w.Header().Set("Link", "<"+u.String()+`>; rel="next"`)
+}
+
+// listError answers a failed list, bad page queries are the client's
+func listError(w http.ResponseWriter, msg string, err error) {
+	if errors.Is(err, models.ErrInvalidPage) {
+		Error(w, http.StatusBadRequest, "invalid page query", err.Error())
+		return
+	}
+	Error(w, http.StatusInternalServerError, msg, err.Error())
+}
+
+// ListHosts returns a page of the synced instances
+func (ctx *APIContext) ListHosts(w http.ResponseWriter, r *http.Request) {
+	q, err := pageQuery(r)
+	if err != nil {
+		Error(w, http.StatusBadRequest, "invalid page query", err.Error())
+		return
+	}
+
+	obj, err := models.InstanceList(q)
+	if err != nil {
+		listError(w, "could not find hosts", err)
+		return
+	}
+
+	rows, err := ctx.dao.WithContext(r.Context()).FindAll(obj)
+	if err != nil {
+		listError(w, "could not find hosts", err)
+		return
+	}
+
+	instances, next, err := obj.UnpackRows(rows)
+	if err != nil {
+		Error(w, http.StatusInternalServerError, "could not unpack hosts", err.Error())
+		return
+	}
+
+	hosts := make([]api.Host, len(instances))
+	for i, inst := range instances {
+		hosts[i] = api.Host{
+			ID:         inst.ID,
+			InstanceID: inst.InstanceID,
+			AccountID:  inst.AccountID,
+			SubnetID:   inst.SubnetID,
+			Tags:       tagMap(inst.Tags),
+		}
+	}
+
+	setNextPage(w, r, next)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(hosts); err != nil {
+		Error(w, http.StatusInternalServerError, "failed to marshal", err.Error())
+	}
+}
+
+// ListSubnets returns a page of the synced subnets
+func (ctx *APIContext) ListSubnets(w http.ResponseWriter, r *http.Request) {
+	q, err := pageQuery(r)
+	if err != nil {
+		Error(w, http.StatusBadRequest, "invalid page query", err.Error())
+		return
+	}
+
+	obj, err := models.SubnetList(q)
+	if err != nil {
+		listError(w, "could not find subnets", err)
+		return
+	}
+
+	rows, err := ctx.dao.WithContext(r.Context()).FindAll(obj)
+	if err != nil {
+		listError(w, "could not find subnets", err)
+		return
+	}
+
+	found, next, err := obj.UnpackRows(rows)
+	if err != nil {
+		Error(w, http.StatusInternalServerError, "could not unpack subnets", err.Error())
+		return
+	}
+
+	subnets := make([]api.Subnet, len(found))
+	for i, s := range found {
+		subnets[i] = api.Subnet{
+			ID:        s.ID,
+			SubnetID:  s.SubnetID,
+			VpcID:     s.VpcID,
+			AccountID: s.AccountID,
+			AZ:        s.AZ,
+			Tags:      tagMap(s.Tags),
+		}
+	}
+
+	setNextPage(w, r, next)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(subnets); err != nil {
+		Error(w, http.StatusInternalServerError, "failed to marshal", err.Error())
+	}
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/mleone896/inventory/api"
+	"github.com/mleone896/inventory/models"
+)
+
+func TestPageQuery(t *testing.T) {
+	r := httptest.NewRequest("GET", "/v1/hosts?limit=10&sort=-color&role=web&tag.team=search", nil)
+	q, err := pageQuery(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Limit != 10 || q.Sort != "-color" || q.Filters["role"] != "web" || q.Filters["tag.team"] != "search" || len(q.Filters) != 2 {
+		t.Errorf("unexpected query %+v", q)
+	}
+
+	r = httptest.NewRequest("GET", "/v1/hosts?limit=ten", nil)
+	if _, err := pageQuery(r); err == nil {
+		t.Errorf("expected a bad limit to fail")
+	}
+}
+
+func TestSetNextPage(t *testing.T) {
+	r := httptest.NewRequest("GET", "/v1/hosts?limit=10&role=web&cursor=old", nil)
+
+	w := httptest.NewRecorder()
+	setNextPage(w, r, "new")
+	if got := w.Header().Get("Link"); got != `</v1/hosts?cursor=new&limit=10&role=web>; rel="next"` {
+		t.Errorf("unexpected link %s", got)
+	}
+	if got := w.Header().Get(api.NextCursorHeader); got != "new" {
+		t.Errorf("unexpected cursor %s", got)
+	}
+
+	w = httptest.NewRecorder()
+	setNextPage(w, r, "")
+	if len(w.Header()) != 0 {
+		t.Errorf("expected no headers on the last page got %v", w.Header())
+	}
+}
+
+func TestSummarizeColors(t *testing.T) {
+	dao, mock := initTestDB()
+	defer dao.Conn.Close()
+
+	mock.ExpectQuery("SELECT").
+		WithArgs((30 * 24 * time.Hour).Seconds()).
+		WillReturnRows(sqlmock.NewRows([]string{"free", "in_use", "cooling_down", "blocked"}).AddRow(40, 7, 3, 1))
+
+	ctx := New(WithDAO(dao), WithCooldownPolicy(models.NewCooldownPolicy(time.Hour, map[string]time.Duration{"prod": 30 * 24 * time.Hour})))
+
+	w := httptest.NewRecorder()
+	ctx.SummarizeColors(w, httptest.NewRequest("GET", "/v1/colors/summary?environment=prod", nil))
+
+	summary := &api.ColorSummary{}
+	if err := json.NewDecoder(w.Body).Decode(summary); err != nil {
+		t.Fatal(err)
+	}
+	if summary.Scope != "prod" || summary.Cooldown != "720h0m0s" || summary.Total != 51 || summary.Counts.InUse != 7 {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there are unfulfilled expectations: %s", err)
+	}
+}
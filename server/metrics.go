@@ -0,0 +1,23 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mleone896/inventory/metrics"
+)
+
+// WithMetrics records request counts and latencies by route template
+func WithMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := recorderFor(w)
+
+		next.ServeHTTP(rec, r)
+
+		route := routeTemplate(r)
+		metrics.HTTPRequests.WithLabelValues(route, r.Method, strconv.Itoa(rec.status)).Inc()
+		metrics.HTTPDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/mleone896/inventory/logging"
+	"github.com/mleone896/inventory/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxRequestIDLen bounds ids accepted from clients so they can't bloat logs
+const maxRequestIDLen = 128
+
+// statusRecorder captures the status code and size written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+	caller string
+}
+
+// WriteHeader ...
+func (s *statusRecorder) WriteHeader(code int) {
+	s.status = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+// Write ...
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	n, err := s.ResponseWriter.Write(b)
+	s.bytes += n
+	return n, err
+}
+
+// recorderFor reuses a recorder installed further up the chain
+func recorderFor(w http.ResponseWriter) *statusRecorder {
+	if rec, ok := w.(*statusRecorder); ok {
+		return rec
+	}
+	return &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+}
+
+// routeName returns the registered name of the matched route
+func routeName(r *http.Request) string {
+	if cur := mux.CurrentRoute(r); cur != nil {
+		if name := cur.GetName(); name != "" {
+			return name
+		}
+	}
+	return "unmatched"
+}
+
+// routeTemplate returns the path template of the matched route
+func routeTemplate(r *http.Request) string {
+	if cur := mux.CurrentRoute(r); cur != nil {
+		if tpl, err := cur.GetPathTemplate(); err == nil {
+			return tpl
+		}
+	}
+	return "unmatched"
+}
+
+// WithRequestID propagates the X-Request-ID header or assigns a new one, the
+// id is returned on the response and stored on the request context
+func WithRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(logging.RequestIDHeader)
+		if !validRequestID(id) {
+			id = logging.NewRequestID()
+		}
+
+		w.Header().Set(logging.RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+	})
+}
+
+// WithTracing opens a server span per request named after the matched
+// handler, continuing any trace propagated by the caller
+func WithTracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+		ctx, span := tracing.Start(ctx, routeName(r),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				tracing.String("http.method", r.Method),
+				tracing.String("http.route", routeTemplate(r)),
+				tracing.String("http.request_id", logging.RequestID(ctx)),
+			),
+		)
+		defer span.End()
+
+		rec := recorderFor(w)
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		span.SetAttributes(attribute.Int("http.status_code", rec.status))
+		if rec.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(rec.status))
+		}
+	})
+}
+
+// WithAccessLog writes one json line per request once the handler returns
+func WithAccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := recorderFor(w)
+
+		next.ServeHTTP(rec, r)
+
+		fields := logging.FromContext(r.Context())
+		fields["handler"] = routeName(r)
+		fields["route"] = routeTemplate(r)
+		fields["method"] = r.Method
+		fields["status"] = rec.status
+		fields["bytes"] = rec.bytes
+		fields["duration_ms"] = float64(time.Since(start)) / float64(time.Millisecond)
+		fields["remote_addr"] = r.RemoteAddr
+		fields["caller"] = "anonymous"
+		if rec.caller != "" {
+			fields["caller"] = rec.caller
+		}
+
+		level := logging.Info
+		if rec.status >= http.StatusInternalServerError {
+			level = logging.Error
+		} else if rec.status >= http.StatusBadRequest {
+			level = logging.Warn
+		}
+
+		logging.Default().Log(level, "request completed", fields)
+	})
+}
+
+// validRequestID accepts short printable ascii ids
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+
+	return true
+}
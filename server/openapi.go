@@ -0,0 +1,424 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mleone896/inventory/api"
+	"github.com/mleone896/inventory/models"
+)
+
+// APIVersion is the version the openapi spec documents
+const APIVersion = "1.0.0"
+
+// OpenAPI is the subset of an OpenAPI 3 document the api is described with
+type OpenAPI struct {
+	OpenAPI    string                          `json:"openapi"`
+	Info       OpenAPIInfo                     `json:"info"`
+	Paths      map[string]map[string]Operation `json:"paths"`
+	Components OpenAPIComponents               `json:"components"`
+	Security   []map[string][]string           `json:"security"`
+}
+
+// OpenAPIInfo ...
+type OpenAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// OpenAPIComponents holds the schemas operations refer to
+type OpenAPIComponents struct {
+	Schemas         map[string]JSONSchema  `json:"schemas"`
+	SecuritySchemes map[string]interface{} `json:"securitySchemes"`
+}
+
+// JSONSchema is a json schema, kept loose as a map
+type JSONSchema map[string]interface{}
+
+// Operation is one method of a path, its id is the name of the route serving it
+type Operation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+// Parameter is a path, query or header parameter
+type Parameter struct {
+	Name        string     `json:"name"`
+	In          string     `json:"in"`
+	Description string     `json:"description,omitempty"`
+	Required    bool       `json:"required,omitempty"`
+	Schema      JSONSchema `json:"schema"`
+}
+
+// RequestBody ...
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Response ...
+type Response struct {
+	Description string               `json:"description"`
+	Headers     map[string]Header    `json:"headers,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// Header is a response header
+type Header struct {
+	Description string     `json:"description"`
+	Schema      JSONSchema `json:"schema"`
+}
+
+// MediaType ...
+type MediaType struct {
+	Schema JSONSchema `json:"schema"`
+}
+
+// apiOperation describes a route of the router for the spec
+type apiOperation struct {
+	method   string
+	path     string
+	name     string
+	summary  string
+	params   []Parameter
+	request  interface{}
+	response interface{}
+	status   int
+	public   bool
+	list     *models.ListKeys
+}
+
+var (
+	dryRunParam = Parameter{
+		Name: "dry_run", In: "query",
+		Description: "preview the allocation without keeping it",
+		Schema:      JSONSchema{"type": "boolean"},
+	}
+	idempotencyParam = Parameter{
+		Name: api.IdempotencyKeyHeader, In: "header",
+		Description: "replay the response of an earlier request with the same key and payload",
+		Schema:      JSONSchema{"type": "string", "maxLength": models.MaxIdempotencyKeyLen},
+	}
+)
+
+var environmentParam = queryParam("environment", "whose cooldown decides what is cooling down", JSONSchema{"type": "string"})
+
+func pathParam(name string) Parameter {
+	return Parameter{Name: name, In: "path", Required: true, Schema: JSONSchema{"type": "string"}}
+}
+
+func queryParam(name, description string, schema JSONSchema) Parameter {
+	return Parameter{Name: name, In: "query", Description: description, Schema: schema}
+}
+
+// listParams are the parameters of a paginated list
+func listParams(keys *models.ListKeys) []Parameter {
+	sorts := make([]string, 0, 2*len(keys.Sorts))
+	for _, key := range keys.Sorts {
+		sorts = append(sorts, key, "-"+key)
+	}
+
+	params := []Parameter{
+		queryParam("limit", "how many to return", JSONSchema{"type": "integer", "minimum": 1, "maximum": models.MaxPageLimit}),
+		queryParam("cursor", "the "+api.NextCursorHeader+" of the previous page", JSONSchema{"type": "string"}),
+		queryParam("sort", "key to sort by, prefixed with - for descending", JSONSchema{"type": "string", "enum": sorts}),
+	}
+	for _, key := range keys.Filters {
+		params = append(params, queryParam(key, "", JSONSchema{"type": "string"}))
+	}
+	if keys.Tags {
+		params = append(params, Parameter{
+			Name: models.TagFilterPrefix + "{key}", In: "query",
+			Description: "only those with the tag, e.g. " + models.TagFilterPrefix + "team=web",
+			Schema:      JSONSchema{"type": "string"},
+		})
+	}
+	return params
+}
+
+// listHeaders are the response headers of a paginated list
+var listHeaders = map[string]Header{
+	"Link":               {Description: `the next page as rel="next"`, Schema: JSONSchema{"type": "string"}},
+	api.NextCursorHeader: {Description: "cursor of the next page, absent on the last", Schema: JSONSchema{"type": "string"}},
+}
+
+// apiOperations lists every route of LoadHandlers, the router tests keep the
+// two in step
+func apiOperations() []apiOperation {
+	ops := []apiOperation{
+		{method: "GET", path: "/v1/openapi.json", name: "OpenAPI", summary: "This document",
+			response: JSONSchema{"type": "object"}, public: true},
+		{method: "POST", path: "/v1/new_host", name: "NewTagsRequest", summary: "Allocate a color and name for a host",
+			params:  []Parameter{dryRunParam, idempotencyParam},
+			request: api.TagsRequest{}, response: api.TagsResponse{}},
+		{method: "POST", path: "/v1/new_hosts", name: "NewTagsRequests", summary: "Allocate several hosts at once, all or nothing",
+			params:  []Parameter{dryRunParam, idempotencyParam},
+			request: api.BulkTagsRequest{}, response: api.BulkTagsResponse{}},
+		{method: "GET", path: "/v1/host/{id}", name: "ListHostAttrsByColor", summary: "The tags of the host holding a color",
+			params: []Parameter{pathParam("id")}, response: api.TagsRequest{}},
+		{method: "GET", path: "/v1/hosts", name: "ListHosts", summary: "The synced instances",
+			list: &models.InstanceListKeys, response: []api.Host{}},
+		{method: "GET", path: "/v1/subnets", name: "ListSubnets", summary: "The synced subnets",
+			list: &models.SubnetListKeys, response: []api.Subnet{}},
+		{method: "GET", path: "/v1/colors", name: "ListColors", summary: "The colors of the palette in a state, free by default",
+			params: []Parameter{
+				queryParam("state", "", JSONSchema{"type": "string", "enum": models.ColorStates}),
+				environmentParam,
+			},
+			list: &models.ColorListKeys, response: []models.Color{}},
+		{method: "GET", path: "/v1/colors/summary", name: "SummarizeColors", summary: "How many colors are in each state",
+			params: []Parameter{environmentParam}, response: api.ColorSummary{}},
+		{method: "POST", path: "/v1/colors", name: "AddColors", summary: "Add colors to the palette",
+			request: api.ColorsRequest{}, response: api.ColorsResponse{}, status: http.StatusCreated},
+		{method: "POST", path: "/v1/colors/import", name: "ImportColors", summary: "Add colors from a text or csv list",
+			request: "text/plain", response: api.ColorsResponse{}, status: http.StatusCreated},
+		{method: "DELETE", path: "/v1/colors/{name}", name: "RetireColor", summary: "Remove a color no instance holds",
+			params: []Parameter{pathParam("name")}, status: http.StatusNoContent},
+		{method: "PATCH", path: "/v1/colors/{name}", name: "PatchColor", summary: "Block or unblock a color",
+			params: []Parameter{pathParam("name")}, request: api.ColorPatch{}, response: models.Color{}},
+		{method: "POST", path: "/v1/colors/{name}/release", name: "ReleaseColor", summary: "Free a color no instance carries",
+			params: []Parameter{pathParam("name")}, response: models.Color{}},
+		{method: "GET", path: "/v1/colors/{name}/history", name: "ColorHistory", summary: "Every host that has held a color",
+			params: []Parameter{pathParam("name")}, response: []models.ColorAssignment{}},
+		{method: "GET", path: "/v1/jobs", name: "ListJobs", summary: "The background jobs and their last run",
+			response: []api.JobStatus{}},
+		{method: "GET", path: "/v1/jobs/{name}/runs", name: "ListJobRuns", summary: "The runs of a job, newest first",
+			params:   []Parameter{pathParam("name"), queryParam("limit", "how many runs to return", JSONSchema{"type": "integer"})},
+			response: []models.JobRun{}},
+		{method: "POST", path: "/v1/jobs/{name}/trigger", name: "TriggerJob", summary: "Start a run of a job now",
+			params: []Parameter{pathParam("name")}, response: map[string]string{}, status: http.StatusAccepted},
+		{method: "GET", path: "/v1/audit", name: "ListAudit", summary: "Audit events, newest first",
+			params: []Parameter{
+				queryParam("since", "RFC3339 timestamp", JSONSchema{"type": "string", "format": "date-time"}),
+				queryParam("actor", "", JSONSchema{"type": "string"}),
+				queryParam("color", "", JSONSchema{"type": "string"}),
+				queryParam("limit", "", JSONSchema{"type": "integer"}),
+			},
+			response: []models.AuditEvent{}},
+		{method: "GET", path: "/v1/combinations", name: "ListCombinations", summary: "The allowed environment, role and pool combinations",
+			response: []models.Combination{}},
+		{method: "POST", path: "/v1/combinations", name: "AddCombination", summary: "Allow a combination",
+			request: models.Combination{}, response: models.Combination{}, status: http.StatusCreated},
+		{method: "DELETE", path: "/v1/combinations/{environment}/{role}/{pool}", name: "RemoveCombination", summary: "Disallow a combination",
+			params: []Parameter{pathParam("environment"), pathParam("role"), pathParam("pool")}, status: http.StatusNoContent},
+	}
+
+	for _, kind := range models.RegistryKinds {
+		plural, single := kindNames(kind)
+		path := "/v1/" + string(kind)
+		name := []Parameter{pathParam("name")}
+
+		ops = append(ops,
+			apiOperation{method: "GET", path: path, name: "List" + plural, summary: "Every registered " + strings.ToLower(single),
+				response: []models.RegistryEntry{}},
+			apiOperation{method: "POST", path: path, name: "Create" + single, summary: "Register a " + strings.ToLower(single),
+				request: RegistryEntryRequest{}, response: models.RegistryEntry{}, status: http.StatusCreated},
+			apiOperation{method: "GET", path: path + "/{name}", name: "Get" + single, summary: "A registered " + strings.ToLower(single),
+				params: name, response: models.RegistryEntry{}},
+			apiOperation{method: "PUT", path: path + "/{name}", name: "Update" + single, summary: "Change the short code and owner of a " + strings.ToLower(single),
+				params: name, request: RegistryEntryRequest{}, response: models.RegistryEntry{}},
+			apiOperation{method: "DELETE", path: path + "/{name}", name: "Delete" + single, summary: "Remove a " + strings.ToLower(single) + " no combination uses",
+				params: name, status: http.StatusNoContent},
+		)
+	}
+
+	return ops
+}
+
+// NewOpenAPI builds the spec of the api, schemas are derived from the types
+// the handlers encode and decode
+func NewOpenAPI() *OpenAPI {
+	spec := &OpenAPI{
+		OpenAPI: "3.0.3",
+		Info:    OpenAPIInfo{Title: "inventory", Version: APIVersion},
+		Paths:   make(map[string]map[string]Operation),
+		Components: OpenAPIComponents{
+			Schemas: make(map[string]JSONSchema),
+			SecuritySchemes: map[string]interface{}{
+				"bearerAuth": map[string]string{"type": "http", "scheme": "bearer"},
+			},
+		},
+		Security: []map[string][]string{{"bearerAuth": {}}},
+	}
+	errSchema := spec.schemaOf(reflect.TypeOf(api.APIError{}))
+
+	for _, op := range apiOperations() {
+		status := op.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		operation := Operation{
+			OperationID: op.name,
+			Summary:     op.summary,
+			Parameters:  op.params,
+			Responses: map[string]Response{
+				"default": {Description: "error", Content: jsonContent(errSchema)},
+			},
+		}
+
+		res := Response{Description: http.StatusText(status)}
+		if op.list != nil {
+			// parameters the table documents win over the generic filters
+			documented := make(map[string]bool)
+			for _, p := range op.params {
+				documented[p.Name] = true
+			}
+			for _, p := range listParams(op.list) {
+				if !documented[p.Name] {
+					operation.Parameters = append(operation.Parameters, p)
+				}
+			}
+			res.Headers = listHeaders
+		}
+		if op.response != nil {
+			res.Content = jsonContent(spec.schemaFor(op.response))
+		}
+		operation.Responses[strconv.Itoa(status)] = res
+
+		switch req := op.request.(type) {
+		case nil:
+		case string:
+			operation.RequestBody = &RequestBody{Required: true, Content: map[string]MediaType{
+				req:        {Schema: JSONSchema{"type": "string"}},
+				"text/csv": {Schema: JSONSchema{"type": "string"}},
+			}}
+		default:
+			operation.RequestBody = &RequestBody{Required: true, Content: jsonContent(spec.schemaFor(req))}
+		}
+
+		if op.public {
+			operation.Security = []map[string][]string{{}}
+		}
+
+		if spec.Paths[op.path] == nil {
+			spec.Paths[op.path] = make(map[string]Operation)
+		}
+		spec.Paths[op.path][strings.ToLower(op.method)] = operation
+	}
+
+	return spec
+}
+
+func jsonContent(s JSONSchema) map[string]MediaType {
+	return map[string]MediaType{"application/json": {Schema: s}}
+}
+
+func (spec *OpenAPI) schemaFor(v interface{}) JSONSchema {
+	if s, ok := v.(JSONSchema); ok {
+		return s
+	}
+	return spec.schemaOf(reflect.TypeOf(v))
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// schemaOf describes t as encoding/json writes it, structs are added to the
+// components and referred to by name
+func (spec *OpenAPI) schemaOf(t reflect.Type) JSONSchema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return JSONSchema{"type": "string", "format": "date-time"}
+	case t.Implements(marshalerType):
+		// e.g. raw json details, any value
+		return JSONSchema{}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return JSONSchema{"type": "string"}
+	case reflect.Bool:
+		return JSONSchema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return JSONSchema{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return JSONSchema{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return JSONSchema{"type": "array", "items": spec.schemaOf(t.Elem())}
+	case reflect.Map:
+		return JSONSchema{"type": "object", "additionalProperties": spec.schemaOf(t.Elem())}
+	case reflect.Struct:
+		return spec.structSchema(t)
+	}
+	return JSONSchema{}
+}
+
+func (spec *OpenAPI) structSchema(t reflect.Type) JSONSchema {
+	ref := JSONSchema{"$ref": "#/components/schemas/" + t.Name()}
+	if _, ok := spec.Components.Schemas[t.Name()]; ok {
+		return ref
+	}
+
+	props := make(map[string]JSONSchema)
+	s := JSONSchema{"type": "object", "properties": props}
+	// registered before the fields so types refering to themselves terminate
+	spec.Components.Schemas[t.Name()] = s
+
+	if required := spec.addFields(t, props); len(required) > 0 {
+		s["required"] = required
+	}
+	return ref
+}
+
+// addFields documents the fields of t in props and returns the required ones,
+// the fields of embedded structs are inlined as encoding/json does
+func (spec *OpenAPI) addFields(t reflect.Type, props map[string]JSONSchema) []string {
+	required := []string{}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+
+		name, opts := f.Name, ""
+		tag, tagged := f.Tag.Lookup("json")
+		if tagged {
+			if tag == "-" {
+				continue
+			}
+			parts := strings.SplitN(tag, ",", 2)
+			if parts[0] != "" {
+				name = parts[0]
+			}
+			if len(parts) > 1 {
+				opts = parts[1]
+			}
+		}
+
+		if f.Anonymous && !tagged && f.Type.Kind() == reflect.Struct {
+			required = append(required, spec.addFields(f.Type, props)...)
+			continue
+		}
+
+		props[name] = spec.schemaOf(f.Type)
+		if !strings.Contains(opts, "omitempty") && f.Type.Kind() != reflect.Ptr {
+			required = append(required, name)
+		}
+	}
+
+	return required
+}
+
+// ServeOpenAPI serves the spec of the api
+func (ctx *APIContext) ServeOpenAPI(spec *OpenAPI) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, spec)
+	}
+}
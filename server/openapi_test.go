@@ -0,0 +1,175 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/mleone896/inventory/api"
+	"github.com/mleone896/inventory/models"
+)
+
+func TestOpenAPIMatchesRouter(t *testing.T) {
+	spec := NewOpenAPI()
+	router := New().LoadHandlers()
+
+	routed := make(map[string]bool)
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil || !strings.HasPrefix(path, "/v1/") {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+
+		for _, method := range methods {
+			key := method + " " + path
+			routed[key] = true
+
+			op, ok := spec.Paths[path][strings.ToLower(method)]
+			if !ok {
+				t.Errorf("%s is routed but not in the spec", key)
+				continue
+			}
+			if op.OperationID != route.GetName() {
+				t.Errorf("expected %s to have operationId %s got %s", key, route.GetName(), op.OperationID)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for path, ops := range spec.Paths {
+		for method := range ops {
+			if key := strings.ToUpper(method) + " " + path; !routed[key] {
+				t.Errorf("%s is in the spec but not routed", key)
+			}
+		}
+	}
+}
+
+func TestOpenAPISchemas(t *testing.T) {
+	spec := NewOpenAPI()
+
+	tags, ok := spec.Components.Schemas["TagsRequest"]
+	if !ok {
+		t.Fatalf("expected a TagsRequest schema got %v", spec.Components.Schemas)
+	}
+
+	props := tags["properties"].(map[string]JSONSchema)
+	for _, field := range []string{"primary_role", "environment", "subnet_id", "name"} {
+		if _, ok := props[field]; !ok {
+			t.Errorf("expected TagsRequest to document %s", field)
+		}
+	}
+	if _, ok := props["tags"]; ok {
+		t.Errorf("expected tags to only be documented on TagsResponse")
+	}
+
+	// the request fields are inlined in the response as encoding/json does
+	props = spec.Components.Schemas["TagsResponse"]["properties"].(map[string]JSONSchema)
+	for _, field := range []string{"primary_role", "name", "tags", "ec2_tags", "violations"} {
+		if _, ok := props[field]; !ok {
+			t.Errorf("expected TagsResponse to document %s", field)
+		}
+	}
+
+	color := spec.Components.Schemas["Color"]["properties"].(map[string]JSONSchema)
+	if color["last_in_use"]["format"] != "date-time" {
+		t.Errorf("expected last_in_use to be a date-time got %v", color["last_in_use"])
+	}
+}
+
+func TestOpenAPIListParams(t *testing.T) {
+	spec := NewOpenAPI()
+
+	for path, ops := range spec.Paths {
+		for method, op := range ops {
+			seen := make(map[string]bool)
+			for _, p := range op.Parameters {
+				if seen[p.In+p.Name] {
+					t.Errorf("%s %s documents %s twice", method, path, p.Name)
+				}
+				seen[p.In+p.Name] = true
+			}
+		}
+	}
+
+	list := spec.Paths["/v1/colors"]["get"]
+	params := make(map[string]Parameter)
+	for _, p := range list.Parameters {
+		params[p.Name] = p
+	}
+	for _, name := range []string{"limit", "cursor", "sort", "name", "environment"} {
+		if _, ok := params[name]; !ok {
+			t.Errorf("expected ListColors to document %s", name)
+		}
+	}
+	if params["state"].Schema["enum"] == nil {
+		t.Errorf("expected the states to be enumerated got %v", params["state"])
+	}
+	if _, ok := list.Responses["200"].Headers[api.NextCursorHeader]; !ok {
+		t.Errorf("expected ListColors to document %s", api.NextCursorHeader)
+	}
+}
+
+func TestServeOpenAPI(t *testing.T) {
+	router := New().LoadHandlers()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/v1/openapi.json", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d", w.Code)
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("expected json got %s", err)
+	}
+	if doc["openapi"] != "3.0.3" {
+		t.Errorf("expected an openapi 3 document got %v", doc["openapi"])
+	}
+}
+
+// the client decodes these models as their api forms, the two must encode
+// to the same fields
+func TestWireTypesMatchModels(t *testing.T) {
+	fields := func(v interface{}) map[string]bool {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := map[string]interface{}{}
+		if err := json.Unmarshal(b, &m); err != nil {
+			t.Fatal(err)
+		}
+		keys := make(map[string]bool, len(m))
+		for k := range m {
+			keys[k] = true
+		}
+		return keys
+	}
+
+	pairs := []struct {
+		model, wire interface{}
+	}{
+		{models.Color{State: "free", Holder: "i-1"}, api.Color{State: "free", Holder: "i-1"}},
+		{models.ColorAssignment{}, api.ColorAssignment{}},
+		{models.JobRun{Error: "failed"}, api.JobRun{Error: "failed"}},
+	}
+
+	for _, p := range pairs {
+		if got, want := fields(p.wire), fields(p.model); !reflect.DeepEqual(got, want) {
+			t.Errorf("expected %T to encode as %T %v got %v", p.wire, p.model, want, got)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+	"github.com/jmoiron/sqlx"
+	"github.com/mleone896/inventory/models"
+)
+
+// registryTTL bounds how long a registry changed through another server is
+// served stale
+const registryTTL = 30 * time.Second
+
+// registryCache keeps the registry between allocations, the registry and
+// combination handlers drop it when they change either
+type registryCache struct {
+	mu       sync.Mutex
+	reg      *models.Registry
+	loadedAt time.Time
+	// gen counts invalidations, a load that started before one is not kept
+	gen uint64
+}
+
+// get returns the cached registry, loading it when dropped or older than
+// registryTTL. Loads run outside the lock so a change can invalidate the
+// cache while one is in flight
+func (c *registryCache) get(conn *sqlx.DB) (*models.Registry, error) {
+	c.mu.Lock()
+	if c.reg != nil && time.Since(c.loadedAt) < registryTTL {
+		reg := c.reg
+		c.mu.Unlock()
+		return reg, nil
+	}
+	gen := c.gen
+	c.mu.Unlock()
+
+	reg, err := models.LoadRegistry(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	if c.gen == gen {
+		c.reg, c.loadedAt = reg, time.Now()
+	}
+	c.mu.Unlock()
+	return reg, nil
+}
+
+// invalidate drops the cached registry so the next allocation reloads it
+func (c *registryCache) invalidate() {
+	c.mu.Lock()
+	c.reg = nil
+	c.gen++
+	c.mu.Unlock()
+}
+
+// kindNames returns the plural and singular forms of kind used in route and
+// operation names, e.g. Environments and Environment
+func kindNames(kind models.RegistryKind) (string, string) {
+	r, size := utf8.DecodeRuneInString(string(kind))
+	plural := string(unicode.ToUpper(r)) + string(kind)[size:]
+	return plural, strings.TrimSuffix(plural, "s")
+}
+
+// RegistryEntryRequest is the body creating or updating an environment, role
+// or pool, the name comes from the path on updates
+type RegistryEntryRequest struct {
+	Name      string `json:"name,omitempty"`
+	ShortCode string `json:"short_code"`
+	Owner     string `json:"owner,omitempty"`
+}
+
+// registryStatus maps registry errors to a status code
+func registryStatus(err error) int {
+	switch err {
+	case models.ErrEntryNotFound:
+		return http.StatusNotFound
+	case models.ErrEntryExists, models.ErrEntryInUse:
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// writeJSON encodes v before writing anything, so a value that fails to
+// encode is answered with a clean 500
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(v); err != nil {
+		Error(w, http.StatusInternalServerError, "failed to marshal", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+// ListEntries returns every entry of the kind registry
+func (ctx *APIContext) ListEntries(kind models.RegistryKind) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		obj := models.NewRegistryEntry(kind)
+		rows, err := ctx.dao.WithContext(r.Context()).FindAll(obj)
+		if err != nil {
+			Error(w, http.StatusInternalServerError, "could not find "+string(kind), err.Error())
+			return
+		}
+
+		entries, err := obj.UnpackRows(rows)
+		if err != nil {
+			Error(w, http.StatusInternalServerError, "could not unpack "+string(kind), err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, entries)
+	}
+}
+
+// GetEntry returns the named entry of the kind registry
+func (ctx *APIContext) GetEntry(kind models.RegistryKind) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		entry := models.NewRegistryEntry(kind, models.WithEntryName(mux.Vars(r)["name"]))
+
+		if err := entry.Get(ctx.dao.WithContext(r.Context()).Conn); err != nil {
+			Error(w, registryStatus(err), "could not find entry", err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, entry)
+	}
+}
+
+// CreateEntry registers a new entry in the kind registry
+func (ctx *APIContext) CreateEntry(kind models.RegistryKind) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req RegistryEntryRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			Error(w, http.StatusBadRequest, "could not read body, please send valid req", err.Error())
+			return
+		}
+
+		entry := models.NewRegistryEntry(kind,
+			models.WithEntryName(req.Name),
+			models.WithShortCode(req.ShortCode),
+			models.WithEntryOwner(req.Owner),
+		)
+		if err := entry.Validate(); err != nil {
+			Error(w, http.StatusUnprocessableEntity, "invalid entry", err.Error())
+			return
+		}
+
+		if _, err := ctx.dao.WithContext(r.Context()).Create(entry); err != nil {
+			Error(w, registryStatus(err), "could not create entry", err.Error())
+			return
+		}
+
+		ctx.registry.invalidate()
+		ctx.audit(r, models.AuditRegistryCreate, "", map[string]interface{}{"kind": kind, "entry": entry})
+		writeJSON(w, http.StatusCreated, entry)
+	}
+}
+
+// UpdateEntry changes the short code and owner of a registered entry
+func (ctx *APIContext) UpdateEntry(kind models.RegistryKind) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req RegistryEntryRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			Error(w, http.StatusBadRequest, "could not read body, please send valid req", err.Error())
+			return
+		}
+
+		entry := models.NewRegistryEntry(kind,
+			models.WithEntryName(mux.Vars(r)["name"]),
+			models.WithShortCode(req.ShortCode),
+			models.WithEntryOwner(req.Owner),
+		)
+		if err := entry.Validate(); err != nil {
+			Error(w, http.StatusUnprocessableEntity, "invalid entry", err.Error())
+			return
+		}
+
+		if err := ctx.dao.WithContext(r.Context()).Update(entry); err != nil {
+			Error(w, registryStatus(err), "could not update entry", err.Error())
+			return
+		}
+
+		ctx.registry.invalidate()
+		ctx.audit(r, models.AuditRegistryUpdate, "", map[string]interface{}{"kind": kind, "entry": entry})
+		writeJSON(w, http.StatusOK, entry)
+	}
+}
+
+// DeleteEntry removes an entry no allowed combination uses
+func (ctx *APIContext) DeleteEntry(kind models.RegistryKind) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := mux.Vars(r)["name"]
+		entry := models.NewRegistryEntry(kind, models.WithEntryName(name))
+
+		if err := ctx.dao.WithContext(r.Context()).Delete(entry); err != nil {
+			Error(w, registryStatus(err), "could not delete entry", err.Error())
+			return
+		}
+
+		ctx.registry.invalidate()
+		ctx.audit(r, models.AuditRegistryDelete, "", map[string]interface{}{"kind": kind, "name": name})
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// ListCombinations returns every allowed environment, role and pool
+func (ctx *APIContext) ListCombinations(w http.ResponseWriter, r *http.Request) {
+	obj := &models.Combination{}
+	rows, err := ctx.dao.WithContext(r.Context()).FindAll(obj)
+	if err != nil {
+		Error(w, http.StatusInternalServerError, "could not find combinations", err.Error())
+		return
+	}
+
+	combos, err := obj.UnpackRows(rows)
+	if err != nil {
+		Error(w, http.StatusInternalServerError, "could not unpack combinations", err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, combos)
+}
+
+// AddCombination allows a role in an environment and pool, once a role has
+// a combination it may only be allocated in its combinations
+func (ctx *APIContext) AddCombination(w http.ResponseWriter, r *http.Request) {
+	var combo models.Combination
+	if err := json.NewDecoder(r.Body).Decode(&combo); err != nil {
+		Error(w, http.StatusBadRequest, "could not read body, please send valid req", err.Error())
+		return
+	}
+
+	if combo.Environment == "" || combo.Role == "" || combo.Pool == "" {
+		Error(w, http.StatusBadRequest, "could not read body, please send valid req", "environment, role and pool must be set")
+		return
+	}
+
+	if _, err := ctx.dao.WithContext(r.Context()).Create(&combo); err != nil {
+		Error(w, registryStatus(err), "could not add combination", err.Error())
+		return
+	}
+
+	ctx.registry.invalidate()
+	ctx.audit(r, models.AuditCombinationAdd, "", combo)
+	writeJSON(w, http.StatusCreated, combo)
+}
+
+// RemoveCombination disallows a combination
+func (ctx *APIContext) RemoveCombination(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	combo := &models.Combination{Environment: vars["environment"], Role: vars["role"], Pool: vars["pool"]}
+
+	if err := ctx.dao.WithContext(r.Context()).Delete(combo); err != nil {
+		Error(w, registryStatus(err), "could not remove combination", err.Error())
+		return
+	}
+
+	ctx.registry.invalidate()
+	ctx.audit(r, models.AuditCombinationRemove, "", combo)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func expectRegistryLoad(mock sqlmock.Sqlmock) {
+	for _, table := range []string{"environments", "roles", "pools"} {
+		mock.ExpectQuery("SELECT \\* from " + table).
+			WillReturnRows(sqlmock.NewRows([]string{"name"}))
+	}
+	mock.ExpectQuery("SELECT \\* from combinations").
+		WillReturnRows(sqlmock.NewRows([]string{"environment", "role", "pool"}))
+}
+
+func TestRegistryCacheReloadsAfterInvalidate(t *testing.T) {
+	dao, mock := initTestDB()
+	defer dao.Conn.Close()
+
+	expectRegistryLoad(mock)
+	expectRegistryLoad(mock)
+
+	cache := &registryCache{}
+	for i := 0; i < 2; i++ {
+		if _, err := cache.get(dao.Conn); err != nil {
+			t.Fatalf("unexpected error loading the registry: %s", err)
+		}
+	}
+
+	cache.invalidate()
+	if _, err := cache.get(dao.Conn); err != nil {
+		t.Fatalf("unexpected error reloading the registry: %s", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there are unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRegistryCacheDropsLoadRacingInvalidate(t *testing.T) {
+	dao, mock := initTestDB()
+	defer dao.Conn.Close()
+
+	for _, table := range []string{"environments", "roles", "pools"} {
+		mock.ExpectQuery("SELECT \\* from " + table).
+			WillReturnRows(sqlmock.NewRows([]string{"name"}))
+	}
+	mock.ExpectQuery("SELECT \\* from combinations").
+		WillDelayFor(100 * time.Millisecond).
+		WillReturnRows(sqlmock.NewRows([]string{"environment", "role", "pool"}))
+
+	cache := &registryCache{}
+	done := make(chan error)
+	go func() {
+		_, err := cache.get(dao.Conn)
+		done <- err
+	}()
+
+	// the registry changes while the load is still reading it
+	time.Sleep(20 * time.Millisecond)
+	cache.invalidate()
+
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error loading the registry: %s", err)
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if cache.reg != nil {
+		t.Errorf("expected a load started before the invalidation not to be cached")
+	}
+}
+
+func TestWriteJSONFailsCleanly(t *testing.T) {
+	w := httptest.NewRecorder()
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"bad": make(chan int)})
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected an unencodable value to be a 500 got: %d", w.Code)
+	}
+	if !strings.HasPrefix(w.Body.String(), "{") || strings.Contains(w.Body.String(), "bad") {
+		t.Errorf("expected only the error to be written got: %s", w.Body.String())
+	}
+}
+
+func TestKindNames(t *testing.T) {
+	plural, single := kindNames("environments")
+	if plural != "Environments" || single != "Environment" {
+		t.Errorf("expected Environments and Environment got %s and %s", plural, single)
+	}
+}
@@ -1,26 +1,74 @@
 package server
 
 import (
-	"log"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/mleone896/inventory/auth"
+	"github.com/mleone896/inventory/awstags"
 	"github.com/mleone896/inventory/db"
+	"github.com/mleone896/inventory/metrics"
+	"github.com/mleone896/inventory/models"
+	"github.com/mleone896/inventory/runners"
 )
 
 // APIContext ...
 type APIContext struct {
-	dao *db.DataObj
+	dao       *db.DataObj
+	runs      map[string]*runners.Run
+	authn     auth.Authenticator
+	cooldowns *models.CooldownPolicy
+	palette   *models.PalettePolicy
+	selector  *models.Selector
+	owners    *models.OwnerPolicy
+	tags      *models.TagPolicy
+	limits    *awstags.Checker
+	registry  *registryCache
+
+	idempotencyWindow time.Duration
 }
 
 // LoadHandlers returns a new router with the available endpoints
 func (ctx APIContext) LoadHandlers() *mux.Router {
 
 	r := mux.NewRouter()
+	r.Use(WithRequestID, WithTracing, WithAccessLog, WithMetrics)
+	r.Handle("/metrics", ctx.require(auth.RoleRead, metrics.Handler())).Methods("GET").Name("Metrics")
+
 	v1 := r.PathPrefix("/v1").Subrouter()
-	v1.HandleFunc("/new_host", WithLogging(ctx.NewTagsReq, "NewTagsRequest")).Methods("POST")
-	v1.HandleFunc("/host/{id}", WithLogging(ctx.ListHostAttrsByColor, "ListHostAttrsByColor")).Methods("GET")
-	v1.HandleFunc("/colors", WithLogging(ctx.ListColors, "ListColors")).Methods("GET")
+	// the spec documents the api and is readable without credentials
+	v1.Handle("/openapi.json", ctx.ServeOpenAPI(NewOpenAPI())).Methods("GET").Name("OpenAPI")
+	v1.Handle("/new_host", ctx.require(auth.RoleAllocate, ctx.idempotent(http.HandlerFunc(ctx.NewTagsReq)))).Methods("POST").Name("NewTagsRequest")
+	v1.Handle("/new_hosts", ctx.require(auth.RoleAllocate, ctx.idempotent(http.HandlerFunc(ctx.NewTagsReqs)))).Methods("POST").Name("NewTagsRequests")
+	v1.Handle("/host/{id}", ctx.require(auth.RoleRead, http.HandlerFunc(ctx.ListHostAttrsByColor))).Methods("GET").Name("ListHostAttrsByColor")
+	v1.Handle("/hosts", ctx.require(auth.RoleRead, http.HandlerFunc(ctx.ListHosts))).Methods("GET").Name("ListHosts")
+	v1.Handle("/subnets", ctx.require(auth.RoleRead, http.HandlerFunc(ctx.ListSubnets))).Methods("GET").Name("ListSubnets")
+	v1.Handle("/colors", ctx.require(auth.RoleRead, http.HandlerFunc(ctx.ListColors))).Methods("GET").Name("ListColors")
+	v1.Handle("/colors", ctx.require(auth.RoleAdmin, http.HandlerFunc(ctx.AddColors))).Methods("POST").Name("AddColors")
+	v1.Handle("/colors/summary", ctx.require(auth.RoleRead, http.HandlerFunc(ctx.SummarizeColors))).Methods("GET").Name("SummarizeColors")
+	v1.Handle("/colors/import", ctx.require(auth.RoleAdmin, http.HandlerFunc(ctx.ImportColors))).Methods("POST").Name("ImportColors")
+	v1.Handle("/colors/{name}", ctx.require(auth.RoleAdmin, http.HandlerFunc(ctx.RetireColor))).Methods("DELETE").Name("RetireColor")
+	v1.Handle("/colors/{name}", ctx.require(auth.RoleAdmin, http.HandlerFunc(ctx.PatchColor))).Methods("PATCH").Name("PatchColor")
+	v1.Handle("/colors/{name}/release", ctx.require(auth.RoleAdmin, http.HandlerFunc(ctx.ReleaseColor))).Methods("POST").Name("ReleaseColor")
+	v1.Handle("/colors/{name}/history", ctx.require(auth.RoleRead, http.HandlerFunc(ctx.ColorHistory))).Methods("GET").Name("ColorHistory")
+	v1.Handle("/jobs", ctx.require(auth.RoleRead, http.HandlerFunc(ctx.ListJobs))).Methods("GET").Name("ListJobs")
+	v1.Handle("/jobs/{name}/runs", ctx.require(auth.RoleRead, http.HandlerFunc(ctx.ListJobRuns))).Methods("GET").Name("ListJobRuns")
+	v1.Handle("/jobs/{name}/trigger", ctx.require(auth.RoleAdmin, http.HandlerFunc(ctx.TriggerJob))).Methods("POST").Name("TriggerJob")
+	v1.Handle("/audit", ctx.require(auth.RoleAdmin, http.HandlerFunc(ctx.ListAudit))).Methods("GET").Name("ListAudit")
+
+	for _, kind := range models.RegistryKinds {
+		// e.g. ListEnvironments, GetEnvironment
+		plural, single := kindNames(kind)
+		v1.Handle("/"+string(kind), ctx.require(auth.RoleRead, ctx.ListEntries(kind))).Methods("GET").Name("List" + plural)
+		v1.Handle("/"+string(kind), ctx.require(auth.RoleAdmin, ctx.CreateEntry(kind))).Methods("POST").Name("Create" + single)
+		v1.Handle("/"+string(kind)+"/{name}", ctx.require(auth.RoleRead, ctx.GetEntry(kind))).Methods("GET").Name("Get" + single)
+		v1.Handle("/"+string(kind)+"/{name}", ctx.require(auth.RoleAdmin, ctx.UpdateEntry(kind))).Methods("PUT").Name("Update" + single)
+		v1.Handle("/"+string(kind)+"/{name}", ctx.require(auth.RoleAdmin, ctx.DeleteEntry(kind))).Methods("DELETE").Name("Delete" + single)
+	}
+	v1.Handle("/combinations", ctx.require(auth.RoleRead, http.HandlerFunc(ctx.ListCombinations))).Methods("GET").Name("ListCombinations")
+	v1.Handle("/combinations", ctx.require(auth.RoleAdmin, http.HandlerFunc(ctx.AddCombination))).Methods("POST").Name("AddCombination")
+	v1.Handle("/combinations/{environment}/{role}/{pool}", ctx.require(auth.RoleAdmin, http.HandlerFunc(ctx.RemoveCombination))).Methods("DELETE").Name("RemoveCombination")
 
 	return r
 }
@@ -28,7 +76,16 @@ func (ctx APIContext) LoadHandlers() *mux.Router {
 // New ...
 func New(opts ...func(*APIContext)) *APIContext {
 
-	actx := &APIContext{}
+	actx := &APIContext{
+		runs:      make(map[string]*runners.Run),
+		cooldowns: models.NewCooldownPolicy(models.DefaultCooldown, nil),
+		palette:   &models.PalettePolicy{Fallback: models.FallbackNone},
+		owners:    models.NewOwnerPolicy(nil, "", models.DefaultOwner),
+		limits:    awstags.NewChecker(awstags.Reject),
+		registry:  &registryCache{},
+
+		idempotencyWindow: models.DefaultIdempotencyWindow,
+	}
 
 	for _, opt := range opts {
 		opt(actx)
@@ -37,15 +94,6 @@ func New(opts ...func(*APIContext)) *APIContext {
 	return actx
 }
 
-// WithLogging decorates the request with some basic logs
-func WithLogging(f http.HandlerFunc, handler string) http.HandlerFunc {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("starting method %s call to %s handler", r.Method, handler)
-		f(w, r)
-		log.Printf("finishing method call to handler %s", r.Method)
-	})
-}
-
 // WithDAO sets the data access object
 func WithDAO(dao *db.DataObj) func(*APIContext) {
 	return func(actx *APIContext) {
@@ -53,3 +101,55 @@ func WithDAO(dao *db.DataObj) func(*APIContext) {
 	}
 
 }
+
+// WithRunners registers the background runners exposed under /v1/jobs
+func WithRunners(runs ...*runners.Run) func(*APIContext) {
+	return func(actx *APIContext) {
+		for _, run := range runs {
+			actx.runs[run.Name] = run
+		}
+	}
+}
+
+// WithCooldownPolicy sets how long released colors rest per environment
+func WithCooldownPolicy(p *models.CooldownPolicy) func(*APIContext) {
+	return func(actx *APIContext) {
+		actx.cooldowns = p
+	}
+}
+
+// WithPalettePolicy sets the fallback and low water mark of the palette
+func WithPalettePolicy(p *models.PalettePolicy) func(*APIContext) {
+	return func(actx *APIContext) {
+		actx.palette = p
+	}
+}
+
+// WithOwnerPolicy sets where the owners of allocated hosts are read from
+func WithOwnerPolicy(p *models.OwnerPolicy) func(*APIContext) {
+	return func(actx *APIContext) {
+		actx.owners = p
+	}
+}
+
+// WithTagPolicy sets the rules generating the extra tags of allocated hosts
+func WithTagPolicy(p *models.TagPolicy) func(*APIContext) {
+	return func(actx *APIContext) {
+		actx.tags = p
+	}
+}
+
+// WithTagLimits sets whether names and tags breaking aws limits are rejected
+// or truncated
+func WithTagLimits(c *awstags.Checker) func(*APIContext) {
+	return func(actx *APIContext) {
+		actx.limits = c
+	}
+}
+
+// WithSelector sets the strategy allocations choose between free colors with
+func WithSelector(s *models.Selector) func(*APIContext) {
+	return func(actx *APIContext) {
+		actx.selector = s
+	}
+}
@@ -0,0 +1,25 @@
+package server
+
+import (
+	"log"
+	"strings"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/reflectx"
+	"github.com/mleone896/inventory/db"
+)
+
+func initTestDB() (*db.DataObj, sqlmock.Sqlmock) {
+
+	//	caller must close the db connection
+	dbm, mock, err := sqlmock.New()
+
+	if err != nil {
+		log.Fatalf("an error %s was not expected when openeing a stub database connection", err)
+	}
+
+	obj := &db.DataObj{Conn: sqlx.NewDb(dbm, "sqlmock")}
+	obj.Conn.Mapper = reflectx.NewMapperFunc("json", strings.ToLower)
+	return obj, mock
+}
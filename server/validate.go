@@ -0,0 +1,120 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/mleone896/inventory/api"
+	"github.com/mleone896/inventory/awstags"
+	"github.com/mleone896/inventory/models"
+)
+
+var (
+	subnetIDPattern   = regexp.MustCompile(`^subnet-[0-9a-f]+$`)
+	instanceIDPattern = regexp.MustCompile(`^i-[0-9a-f]+$`)
+	dnsLabelPattern   = regexp.MustCompile(`^[a-z]([a-z0-9-]*[a-z0-9])?$`)
+)
+
+// maxLabelLen is the longest dns label, and so the longest host name part
+const maxLabelLen = 63
+
+// maxOwnerLen is the size of the owner column of color assignments
+const maxOwnerLen = 256
+
+// FieldErrors collects every problem found with a request
+type FieldErrors []api.FieldError
+
+// Error lets field errors found while allocating be returned as an error
+func (f FieldErrors) Error() string {
+	msgs := make([]string, len(f))
+	for i, e := range f {
+		msgs[i] = e.Field + " " + e.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// add records a problem with field
+func (f *FieldErrors) add(field, format string, args ...interface{}) {
+	*f = append(*f, api.FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// prefixed returns the errors with their fields nested under prefix
+func (f FieldErrors) prefixed(prefix string) FieldErrors {
+	out := make(FieldErrors, len(f))
+	for i, e := range f {
+		e.Field = prefix + "." + e.Field
+		out[i] = e
+	}
+	return out
+}
+
+// violationErrors reports the aws limits a generated name or tag broke
+func violationErrors(v awstags.Violations) FieldErrors {
+	errs := make(FieldErrors, len(v))
+	for i, e := range v {
+		errs[i] = api.FieldError{Field: e.Field, Message: e.Message}
+	}
+	return errs
+}
+
+// label checks value is present and usable as part of a host name
+func (f *FieldErrors) label(field, value string) {
+	switch {
+	case value == "":
+		f.add(field, "is required")
+	case len(value) > maxLabelLen:
+		f.add(field, "must be at most %d characters", maxLabelLen)
+	case !dnsLabelPattern.MatchString(value):
+		f.add(field, "must be lower case letters, digits and hyphens, starting with a letter")
+	}
+}
+
+// validateTagsRequest returns every problem with the shape of the request,
+// none when it is valid. Which environments, roles and pools are allowed is
+// left to the registry, see registryErrors
+func validateTagsRequest(h *api.TagsRequest) FieldErrors {
+	errs := FieldErrors{}
+
+	errs.label("primary_role", h.Role)
+	errs.label("environment", h.Environment)
+	errs.label("pool", h.Pool)
+
+	switch {
+	case h.SubnetID == "":
+		errs.add("subnet_id", "is required")
+	case !subnetIDPattern.MatchString(h.SubnetID):
+		errs.add("subnet_id", "must match subnet-[0-9a-f]+")
+	}
+
+	if h.Color != "" {
+		if err := models.ValidateColorName(h.Color); err != nil {
+			errs.add("color", "%s", err)
+		}
+	}
+
+	if h.Replaces != "" && !instanceIDPattern.MatchString(h.Replaces) {
+		errs.add("replaces_instance_id", "must match i-[0-9a-f]+")
+	}
+
+	if len(h.Owner) > maxOwnerLen {
+		errs.add("owner", "must be at most %d characters", maxOwnerLen)
+	}
+
+	if h.Name != "" && strings.ToLower(h.Name) != h.Name {
+		errs.add("name", "must be lower case")
+	}
+
+	return errs
+}
+
+// ValidationError writes a 400 listing every field that was rejected
+func ValidationError(w http.ResponseWriter, errs FieldErrors) {
+	writeAPIError(w, api.APIError{
+		Code:    http.StatusBadRequest,
+		Message: "request failed validation",
+		Detail:  fmt.Sprintf("%d invalid field(s)", len(errs)),
+		Details: errs,
+	})
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mleone896/inventory/api"
+	"github.com/mleone896/inventory/models"
+)
+
+func TestValidateReportsEveryField(t *testing.T) {
+	req := &api.TagsRequest{
+		Role:        "Web_Server",
+		Environment: "-qa",
+		SubnetID:    "subnet-XYZ",
+		Replaces:    "instance-1",
+	}
+
+	errs := validateTagsRequest(req)
+
+	got := map[string]api.FieldError{}
+	for _, e := range errs {
+		got[e.Field] = e
+	}
+
+	for _, field := range []string{"primary_role", "environment", "pool", "subnet_id", "replaces_instance_id"} {
+		if _, ok := got[field]; !ok {
+			t.Errorf("expected an error for %s got: %+v", field, errs)
+		}
+	}
+
+	ok := &api.TagsRequest{Role: "web-api", Environment: "prod", Pool: "blue", SubnetID: "subnet-0a1b2c"}
+	if errs := validateTagsRequest(ok); len(errs) != 0 {
+		t.Errorf("expected a valid request got: %+v", errs)
+	}
+}
+
+func TestRegistryListsAllowedValues(t *testing.T) {
+	reg := &models.Registry{Entries: map[models.RegistryKind]map[string]models.RegistryEntry{
+		models.Environments: {"prod": {Name: "prod"}, "dev": {Name: "dev"}},
+	}}
+
+	errs := registryErrors(reg, &api.TagsRequest{Role: "web", Environment: "qa", Pool: "blue"})
+	if len(errs) != 1 || errs[0].Field != "environment" {
+		t.Fatalf("expected only the unregistered environment to be rejected got: %+v", errs)
+	}
+
+	if allowed := errs[0].Allowed; len(allowed) != 2 {
+		t.Errorf("expected the registered environments to be listed got: %v", allowed)
+	}
+}
+
+func TestValidationErrorBody(t *testing.T) {
+	w := httptest.NewRecorder()
+	ValidationError(w, FieldErrors{{Field: "pool", Message: "is required"}})
+
+	var body api.APIError
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	if w.Code != 400 || len(body.Details) != 1 || body.Details[0].Field != "pool" {
+		t.Errorf("unexpected validation error: %d %+v", w.Code, body)
+	}
+}
@@ -0,0 +1,134 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentationName identifies the spans created by this service
+const InstrumentationName = "github.com/mleone896/inventory"
+
+// DefaultEndpoint is the otlp/http port of a collector on the same host
+const DefaultEndpoint = "localhost:4318"
+
+// Config controls whether and where spans are exported
+type Config struct {
+	enabled     bool
+	endpoint    string
+	insecure    bool
+	serviceName string
+	sampleRatio float64
+}
+
+// ConfigFunc allows caller to set config options without accessing the un
+// exported structs fields directly
+type ConfigFunc func(*Config)
+
+// WithEnabled turns exporting on, tracing is a no-op otherwise
+func WithEnabled(enabled bool) ConfigFunc {
+	return func(c *Config) {
+		c.enabled = enabled
+	}
+}
+
+// WithEndpoint sets the host:port of the otlp/http collector
+func WithEndpoint(endpoint string) ConfigFunc {
+	return func(c *Config) {
+		c.endpoint = endpoint
+	}
+}
+
+// WithInsecure exports over plain http
+func WithInsecure(insecure bool) ConfigFunc {
+	return func(c *Config) {
+		c.insecure = insecure
+	}
+}
+
+// WithServiceName sets the service.name resource attribute
+func WithServiceName(name string) ConfigFunc {
+	return func(c *Config) {
+		c.serviceName = name
+	}
+}
+
+// WithSampleRatio sets the fraction of new traces that are sampled
+func WithSampleRatio(ratio float64) ConfigFunc {
+	return func(c *Config) {
+		c.sampleRatio = ratio
+	}
+}
+
+// Setup installs the global tracer provider and returns a func that flushes
+// and stops it. When tracing is disabled nothing is installed and the global
+// no-op tracer is left in place
+func Setup(ctx context.Context, opts ...ConfigFunc) (func(context.Context) error, error) {
+	cfg := &Config{
+		endpoint:    DefaultEndpoint,
+		insecure:    true,
+		serviceName: "inventory",
+		sampleRatio: 1,
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	noop := func(context.Context) error { return nil }
+	if !cfg.enabled {
+		return noop, nil
+	}
+
+	exportOpts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.endpoint)}
+	if cfg.insecure {
+		exportOpts = append(exportOpts, otlptracehttp.WithInsecure())
+	}
+
+	exporter, err := otlptracehttp.New(ctx, exportOpts...)
+	if err != nil {
+		return noop, fmt.Errorf("could not create otlp exporter: %s", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.sampleRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceNameKey.String(cfg.serviceName),
+		)),
+	)
+
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	return tp.Shutdown, nil
+}
+
+// Start begins a span named name as a child of any span in ctx
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(InstrumentationName).Start(ctx, name, opts...)
+}
+
+// End records err on the span, if any, and ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// String is a shorthand for a string span attribute
+func String(k, v string) attribute.KeyValue {
+	return attribute.String(k, v)
+}